@@ -4,8 +4,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
-	"maelstrom-unique-ids/pkg/snowflake"
-	"os"
+	"maelstrom-shared/snowflake"
+	"time"
 
 	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
 )
@@ -13,10 +13,18 @@ import (
 func main() {
 	n := maelstrom.NewNode()
 
-	worker, err := snowflake.NewWorker(int64(os.Getpid()))
-	if err != nil {
-		panic(fmt.Sprintf("Failed to create snowflake generator: %v", err))
-	}
+	var worker *snowflake.Worker
+
+	n.Handle("init", func(msg maelstrom.Message) error {
+		w, err := snowflake.NewWorkerForNode(n.ID())
+		if err != nil {
+			return fmt.Errorf("failed to create snowflake generator: %w", err)
+		}
+		w.SetSkewPolicy(snowflake.SkewBorrow, time.Second)
+
+		worker = w
+		return nil
+	})
 
 	n.Handle("echo", func(msg maelstrom.Message) error {
 		// Unmarshal the message body as an loosely-typed map.
@@ -37,6 +45,26 @@ func main() {
 		if err := json.Unmarshal(msg.Body, &body); err != nil {
 			return err
 		}
+
+		// a count asks for a run of ids rather than a single one
+		if count, ok := body["count"].(float64); ok {
+			if count < 0 || count > snowflake.MaxRun || count != float64(int(count)) {
+				return maelstrom.NewRPCError(maelstrom.MalformedRequest,
+					fmt.Sprintf("count must be a whole number from 0 to %d, got %v", snowflake.MaxRun, count))
+			}
+
+			ids, err := worker.NextIds(int(count))
+			if err != nil {
+				return err
+			}
+
+			delete(body, "count")
+			body["type"] = "generate_ok"
+			body["ids"] = ids
+
+			return n.Reply(msg, body)
+		}
+
 		id, err := worker.NextId()
 		if err != nil {
 			return err
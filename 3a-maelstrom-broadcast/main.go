@@ -4,8 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
-	"maelstrom-broadcast/snowflake"
-	"os"
+	"maelstrom-shared/snowflake"
 
 	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
 )
@@ -14,10 +13,17 @@ func main() {
 	n := maelstrom.NewNode()
     //errorPrint := log.New(os.Stderr, "", 1);
 
-	worker, err := snowflake.NewWorker(int64(os.Getpid()))
-	if err != nil {
-		panic(fmt.Sprintf("Failed to create snowflake generator: %v", err))
-	}
+	var worker *snowflake.Worker
+
+	n.Handle("init", func(msg maelstrom.Message) error {
+		w, err := snowflake.NewWorkerForNode(n.ID())
+		if err != nil {
+			return fmt.Errorf("failed to create snowflake generator: %w", err)
+		}
+
+		worker = w
+		return nil
+	})
 	msgs := make([]int, 0)
 
 	n.Handle("echo", func(msg maelstrom.Message) error {
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Config tunes how eagerly ids are sent on to neighbours, trading messages
+// per broadcast against how long a broadcast takes to reach every node.
+type Config struct {
+	// GossipInterval is how long a new batch waits for more ids before it
+	// is sent. Zero sends it straight away.
+	GossipInterval time.Duration
+	// MaxBatch sends a batch as soon as this many ids are waiting, without
+	// waiting for the interval. Zero turns this off.
+	MaxBatch int
+}
+
+var DefaultConfig = Config{
+	GossipInterval: 0,
+	MaxBatch:       0,
+}
+
+// ConfigFromEnv starts from DefaultConfig and overrides it with
+// GOSSIP_INTERVAL and GOSSIP_MAX_BATCH when they are set.
+func ConfigFromEnv() (Config, error) {
+	cfg := DefaultConfig
+
+	if val, ok := os.LookupEnv("GOSSIP_INTERVAL"); ok {
+		interval, err := time.ParseDuration(val)
+		if err != nil {
+			return cfg, fmt.Errorf("parse GOSSIP_INTERVAL: %w", err)
+		}
+		cfg.GossipInterval = interval
+	}
+
+	if val, ok := os.LookupEnv("GOSSIP_MAX_BATCH"); ok {
+		maxBatch, err := strconv.Atoi(val)
+		if err != nil {
+			return cfg, fmt.Errorf("parse GOSSIP_MAX_BATCH: %w", err)
+		}
+		cfg.MaxBatch = maxBatch
+	}
+
+	return cfg, nil
+}
+
+func (c Config) validate() error {
+	if c.GossipInterval < 0 {
+		return fmt.Errorf("invalid gossip interval %v: cannot be negative", c.GossipInterval)
+	}
+	if c.MaxBatch < 0 {
+		return fmt.Errorf("invalid max batch %d: cannot be negative", c.MaxBatch)
+	}
+
+	return nil
+}
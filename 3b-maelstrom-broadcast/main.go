@@ -2,10 +2,11 @@ package main
 
 import (
 	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
-	"maelstrom-broadcast/snowflake"
-	"os"
+	"maelstrom-shared/snowflake"
+	"maelstrom-shared/topology"
 	"sync"
 
 	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
@@ -15,15 +16,80 @@ func main() {
 	n := maelstrom.NewNode()
 	//errorPrint := log.New(os.Stderr, "", 1);
 
-	worker, err := snowflake.NewWorker(int64(os.Getpid()))
+	cfg, err := ConfigFromEnv()
 	if err != nil {
-		panic(fmt.Sprintf("Failed to create snowflake generator: %v", err))
+		panic(err)
 	}
-	server := &Server{
-		msgIds: []int{},
+
+	flag.DurationVar(&cfg.GossipInterval, "gossip-interval", cfg.GossipInterval, "longest a new batch waits for more ids, 0 to send it straight away")
+	flag.IntVar(&cfg.MaxBatch, "max-batch", cfg.MaxBatch, "send a batch as soon as this many ids are waiting, 0 to only use the interval")
+	flag.Parse()
+
+	server := NewServer()
+	outboxes, err := NewOutboxes(n, cfg)
+	if err != nil {
+		panic(err)
 	}
+
+	// worker and nbrs are set by the init and topology handlers while other
+	// handlers may be reading them
+	var workerMu sync.RWMutex
+	var worker *snowflake.Worker
+	var nbrsMu sync.RWMutex
 	var nbrs []string
 
+	nextId := func() (uint64, error) {
+		workerMu.RLock()
+		w := worker
+		workerMu.RUnlock()
+
+		return w.NextId()
+	}
+
+	// forward passes a new id on to every neighbour but the one it came from
+	// and records it once they have all queued it. If a neighbour's outbox
+	// is full it returns false and leaves the id unrecorded, so that it is
+	// forwarded again when the sender retries.
+	forward := func(msgId int, from string) bool {
+		if server.has(msgId) {
+			return true
+		}
+
+		nbrsMu.RLock()
+		current := nbrs
+		nbrsMu.RUnlock()
+
+		queued := true
+		for _, nbr := range current {
+			if nbr == from {
+				continue
+			}
+
+			if !outboxes.Push(nbr, msgId) {
+				queued = false
+			}
+		}
+
+		if queued {
+			server.add(msgId)
+		}
+
+		return queued
+	}
+
+	n.Handle("init", func(msg maelstrom.Message) error {
+		w, err := snowflake.NewWorkerForNode(n.ID())
+		if err != nil {
+			return fmt.Errorf("failed to create snowflake generator: %w", err)
+		}
+
+		workerMu.Lock()
+		worker = w
+		workerMu.Unlock()
+
+		return nil
+	})
+
 	n.Handle("broadcast", func(msg maelstrom.Message) error {
 		var body map[string]any
 		if err := json.Unmarshal(msg.Body, &body); err != nil {
@@ -33,39 +99,51 @@ func main() {
 		// message field is guaranteed to be an integer
 		msgId := int(body["message"].(float64))
 
-		// handle gossip
-		if !server.seen(msgId) {
-			var msgBody map[string]any
-			if err := json.Unmarshal(msg.Body, &msgBody); err != nil {
-				return err
-			}
-
-			for _, nbr := range nbrs {
-				if nbr == msg.Src {
-					continue
-				}
-
-				nextId, err := worker.NextId()
-				if err != nil {
-					return err
-				}
-				msgBody["msg_id"] = nextId
-				n.Send(nbr, msgBody)
-			}
-			server.add(msgId)
+		if !forward(msgId, msg.Src) {
+			return maelstrom.NewRPCError(maelstrom.TemporarilyUnavailable,
+				fmt.Sprintf("outbox full, cannot forward message %d yet", msgId))
 		}
 
 		delete(body, "message")
 		body["type"] = "broadcast_ok"
-		nextId, err := worker.NextId()
+		id, err := nextId()
 		if err != nil {
 			return err
 		}
-		body["msg_id"] = nextId
+		body["msg_id"] = id
 
 		return n.Reply(msg, body)
 	})
 
+	n.Handle("gossip", func(msg maelstrom.Message) error {
+		var body GossipBody
+		if err := json.Unmarshal(msg.Body, &body); err != nil {
+			return err
+		}
+
+		// acknowledge every id we have, new or not, so the sender stops
+		// resending it. Ids we couldn't queue for our own neighbours are left
+		// out, so the sender holds on to them until we have room.
+		acked := make([]int, 0, len(body.Messages))
+		for _, msgId := range body.Messages {
+			if forward(msgId, msg.Src) {
+				acked = append(acked, msgId)
+			}
+		}
+
+		return n.Send(msg.Src, GossipBody{Type: "gossip_ok", Messages: acked})
+	})
+
+	n.Handle("gossip_ok", func(msg maelstrom.Message) error {
+		var body GossipBody
+		if err := json.Unmarshal(msg.Body, &body); err != nil {
+			return err
+		}
+
+		outboxes.Ack(msg.Src, body.Messages)
+		return nil
+	})
+
 	n.Handle("read", func(msg maelstrom.Message) error {
 		var body map[string]any
 
@@ -75,11 +153,11 @@ func main() {
 
 		body["messages"] = server.Msgs()
 		body["type"] = "read_ok"
-		nextId, err := worker.NextId()
+		id, err := nextId()
 		if err != nil {
 			return err
 		}
-		body["msg_id"] = nextId
+		body["msg_id"] = id
 
 		return n.Reply(msg, body)
 	})
@@ -91,23 +169,22 @@ func main() {
 			return err
 		}
 
-		topology := body["topology"].(map[string]any)
-		topology_nbrs := topology[n.ID()].([]any)
-
-		nbrs = make([]string, len(topology_nbrs))
-
-		for i := 0; i < len(topology_nbrs); i++ {
-			nbrs[i] = topology_nbrs[i].(string)
+		topologyNbrs, err := topology.Parse(msg.Body, n.ID())
+		if err != nil {
+			return err
 		}
+		nbrsMu.Lock()
+		nbrs = topologyNbrs
+		nbrsMu.Unlock()
 
 		out := make(map[string]any)
 		out["type"] = "topology_ok"
 
-		nextId, err := worker.NextId()
+		id, err := nextId()
 		if err != nil {
 			return err
 		}
-		body["msg_id"] = nextId
+		body["msg_id"] = id
 
 		return n.Reply(msg, out)
 	})
@@ -116,27 +193,3 @@ func main() {
 		log.Fatal(err)
 	}
 }
-
-type Server struct {
-	msgIds []int
-	mu     sync.Mutex
-}
-
-func (s *Server) seen(i int) bool {
-	for _, val := range s.msgIds {
-		if val == i {
-			return true
-		}
-	}
-	return false
-}
-
-func (s *Server) add(i int) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.msgIds = append(s.msgIds, i)
-}
-
-func (s *Server) Msgs() []int {
-	return s.msgIds
-}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+const (
+	// outboxLimit caps how many ids can wait on one neighbour.
+	outboxLimit = 1024
+
+	ackTimeout = time.Second
+	minBackoff = 100 * time.Millisecond
+	maxBackoff = 2 * time.Second
+)
+
+// GossipBody carries message ids to a neighbour, which acknowledges them by
+// sending the same ids back in a gossip_ok.
+type GossipBody struct {
+	Type     string `json:"type"`
+	Messages []int  `json:"messages"`
+}
+
+// Outbox delivers message ids to a single neighbour, resending them with
+// backoff until the neighbour acknowledges them. Ids sent while a partition
+// is up are delivered once it heals.
+//
+// Only one batch is in flight at a time. Ids pushed meanwhile are merged into
+// the next one, so a slow or partitioned neighbour costs one entry per
+// distinct id rather than a message and a goroutine per push. A batch started
+// while nothing is in flight is held back for up to the gossip interval, or
+// until MaxBatch ids are waiting, so ids arriving close together share it.
+//
+// Batches and acks are plain messages rather than an RPC and its reply, as
+// an RPC's callback is never cleaned up if the reply doesn't come.
+//
+// At most outboxLimit ids wait on a neighbour. Once that many are pending
+// new ids are refused rather than queued, and it is up to the caller to push
+// back on whoever sent them until the neighbour catches up.
+type Outbox struct {
+	n    *maelstrom.Node
+	dest string
+	cfg  Config
+
+	limit      int
+	ackTimeout time.Duration
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	mu sync.Mutex
+	// pending holds the ids dest hasn't acknowledged
+	pending map[int]struct{}
+	// wake is signalled whenever pending changes
+	wake  chan struct{}
+	start sync.Once
+}
+
+func NewOutbox(n *maelstrom.Node, dest string, cfg Config) (*Outbox, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	return &Outbox{
+		n:          n,
+		dest:       dest,
+		cfg:        cfg,
+		limit:      outboxLimit,
+		ackTimeout: ackTimeout,
+		minBackoff: minBackoff,
+		maxBackoff: maxBackoff,
+		pending:    make(map[int]struct{}),
+		wake:       make(chan struct{}, 1),
+	}, nil
+}
+
+// Push queues id for delivery. It returns false without queueing it if the
+// outbox is full.
+func (o *Outbox) Push(id int) bool {
+	o.start.Do(func() { go o.run() })
+
+	o.mu.Lock()
+	_, pres := o.pending[id]
+	if !pres && len(o.pending) >= o.limit {
+		o.mu.Unlock()
+		return false
+	}
+	o.pending[id] = struct{}{}
+	o.mu.Unlock()
+
+	o.signal()
+
+	return true
+}
+
+// Ack records that dest has ids.
+func (o *Outbox) Ack(ids []int) {
+	o.mu.Lock()
+	for _, id := range ids {
+		delete(o.pending, id)
+	}
+	o.mu.Unlock()
+
+	o.signal()
+}
+
+func (o *Outbox) signal() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// batch returns every id waiting on dest.
+func (o *Outbox) batch() []int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	ids := make([]int, 0, len(o.pending))
+	for id := range o.pending {
+		ids = append(ids, id)
+	}
+
+	return ids
+}
+
+// acked reports whether dest has acknowledged every id in batch.
+func (o *Outbox) acked(batch []int) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for _, id := range batch {
+		if _, pres := o.pending[id]; pres {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (o *Outbox) run() {
+	backoff := o.minBackoff
+	// idle is set while nothing is in flight, so the next batch is new
+	idle := true
+	for {
+		if len(o.batch()) == 0 {
+			idle = true
+			<-o.wake
+			continue
+		}
+
+		if idle {
+			o.linger()
+			idle = false
+		}
+
+		batch := o.batch()
+
+		err := o.n.Send(o.dest, GossipBody{Type: "gossip", Messages: batch})
+		if err != nil {
+			log.Printf("error sending to %s: %v", o.dest, err)
+		}
+
+		if o.waitForAck(batch) {
+			backoff = o.minBackoff
+			continue
+		}
+
+		time.Sleep(backoff)
+		backoff = min(2*backoff, o.maxBackoff)
+	}
+}
+
+// linger holds a new batch back until the gossip interval is up or MaxBatch
+// ids are waiting.
+func (o *Outbox) linger() {
+	if o.cfg.GossipInterval == 0 {
+		return
+	}
+
+	timer := time.NewTimer(o.cfg.GossipInterval)
+	defer timer.Stop()
+
+	for o.cfg.MaxBatch == 0 || o.waiting() < o.cfg.MaxBatch {
+		select {
+		case <-o.wake:
+		case <-timer.C:
+			return
+		}
+	}
+}
+
+func (o *Outbox) waiting() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return len(o.pending)
+}
+
+// waitForAck waits for dest to acknowledge batch, reporting whether it did
+// before the ack timeout.
+func (o *Outbox) waitForAck(batch []int) bool {
+	timer := time.NewTimer(o.ackTimeout)
+	defer timer.Stop()
+
+	for !o.acked(batch) {
+		select {
+		case <-o.wake:
+		case <-timer.C:
+			return o.acked(batch)
+		}
+	}
+
+	return true
+}
+
+// Outboxes holds an Outbox for every node we have sent to. They outlive
+// topology changes so nothing queued for an old neighbour is lost.
+type Outboxes struct {
+	n   *maelstrom.Node
+	cfg Config
+
+	mu    sync.Mutex
+	boxes map[string]*Outbox
+}
+
+func NewOutboxes(n *maelstrom.Node, cfg Config) (*Outboxes, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	return &Outboxes{
+		n:     n,
+		cfg:   cfg,
+		boxes: make(map[string]*Outbox),
+	}, nil
+}
+
+func (o *Outboxes) box(dest string) *Outbox {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	box, ok := o.boxes[dest]
+	if !ok {
+		// cfg was validated by NewOutboxes
+		box, _ = NewOutbox(o.n, dest, o.cfg)
+		o.boxes[dest] = box
+	}
+
+	return box
+}
+
+// Push queues id for delivery to dest, returning false if dest's outbox is
+// full.
+func (o *Outboxes) Push(dest string, id int) bool {
+	return o.box(dest).Push(id)
+}
+
+// Ack records that dest has ids.
+func (o *Outboxes) Ack(dest string, ids []int) {
+	o.box(dest).Ack(ids)
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+// flakyNbr stands in for a neighbour behind a partition: it drops the first
+// few batches it is sent and acknowledges the rest.
+type flakyNbr struct {
+	mu      sync.Mutex
+	buf     bytes.Buffer
+	drop    int
+	batches []maelstrom.Message
+	reply   *io.PipeWriter
+}
+
+func (f *flakyNbr) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.buf.Write(p)
+	for {
+		line, err := f.buf.ReadBytes('\n')
+		if err != nil {
+			f.buf.Write(line)
+			break
+		}
+
+		var msg maelstrom.Message
+		json.Unmarshal(line, &msg)
+
+		f.batches = append(f.batches, msg)
+		if len(f.batches) <= f.drop {
+			continue
+		}
+
+		var body GossipBody
+		json.Unmarshal(msg.Body, &body)
+
+		replyBody, _ := json.Marshal(GossipBody{Type: "gossip_ok", Messages: body.Messages})
+		reply, _ := json.Marshal(maelstrom.Message{Src: msg.Dest, Dest: msg.Src, Body: replyBody})
+		go f.reply.Write(append(reply, '\n'))
+	}
+
+	return len(p), nil
+}
+
+func (f *flakyNbr) sent() []maelstrom.Message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.batches)
+}
+
+// newTestOutbox connects an outbox on n0 to nbr, with timeouts short enough
+// for retries to happen during the test.
+func newTestOutbox(t *testing.T, nbr *flakyNbr, cfg Config) *Outbox {
+	r, w := io.Pipe()
+	t.Cleanup(func() { w.Close() })
+	nbr.reply = w
+
+	n := maelstrom.NewNode()
+	n.Init("n0", []string{"n0", "n1"})
+	n.Stdin = r
+	n.Stdout = nbr
+
+	box, err := NewOutbox(n, "n1", cfg)
+	if err != nil {
+		t.Fatalf("error creating outbox: %v", err)
+	}
+	box.ackTimeout = 20 * time.Millisecond
+	box.minBackoff = time.Millisecond
+	box.maxBackoff = time.Millisecond
+
+	n.Handle("gossip_ok", func(msg maelstrom.Message) error {
+		var body GossipBody
+		if err := json.Unmarshal(msg.Body, &body); err != nil {
+			return err
+		}
+		box.Ack(body.Messages)
+		return nil
+	})
+	go n.Run()
+
+	return box
+}
+
+func waitForEmpty(t *testing.T, box *Outbox) {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if len(box.batch()) == 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("expected every id to be acknowledged, %v still waiting", box.batch())
+}
+
+func TestOutboxRetriesUntilAcked(t *testing.T) {
+	nbr := &flakyNbr{drop: 1}
+	box := newTestOutbox(t, nbr, DefaultConfig)
+
+	box.Push(1)
+	waitForEmpty(t, box)
+
+	sent := nbr.sent()
+	if len(sent) != 2 {
+		t.Fatalf("expected one retry after the dropped batch, got %d batches", len(sent))
+	}
+
+	// retries are plain messages, so no reply callback is left behind for
+	// the attempts that were never answered
+	for _, msg := range sent {
+		var body maelstrom.MessageBody
+		json.Unmarshal(msg.Body, &body)
+		if body.MsgID != 0 {
+			t.Fatalf("expected batches to be sent without a msg_id, got %s", msg.Body)
+		}
+	}
+}
+
+func TestOutboxMergesPendingIds(t *testing.T) {
+	// a neighbour that stays partitioned for a while
+	nbr := &flakyNbr{drop: 3}
+	box := newTestOutbox(t, nbr, DefaultConfig)
+
+	expected := make([]int, 0)
+	for i := 0; i < 100; i++ {
+		box.Push(i)
+		expected = append(expected, i)
+	}
+	waitForEmpty(t, box)
+
+	sent := nbr.sent()
+	if len(sent) > 5 {
+		t.Fatalf("expected pending ids to be merged into a few batches, got %d", len(sent))
+	}
+
+	var last GossipBody
+	json.Unmarshal(sent[len(sent)-1].Body, &last)
+	slices.Sort(last.Messages)
+	if !slices.Equal(last.Messages, expected) {
+		t.Fatalf("expected the batch after the partition to carry every id, got %v", last.Messages)
+	}
+}
+
+func TestOutboxRefusesIdsOverLimit(t *testing.T) {
+	// a neighbour that stays partitioned until the test heals it
+	nbr := &flakyNbr{drop: math.MaxInt}
+	box := newTestOutbox(t, nbr, DefaultConfig)
+	box.limit = 3
+
+	for i := 0; i < 3; i++ {
+		if !box.Push(i) {
+			t.Fatalf("expected id %d to be queued", i)
+		}
+	}
+	if box.Push(3) {
+		t.Fatalf("expected an id over the limit to be refused")
+	}
+	if !box.Push(1) {
+		t.Fatalf("expected an id already waiting to be accepted")
+	}
+	if waiting := box.waiting(); waiting != 3 {
+		t.Fatalf("expected %d ids waiting, got %d", 3, waiting)
+	}
+
+	nbr.mu.Lock()
+	nbr.drop = 0
+	nbr.mu.Unlock()
+	waitForEmpty(t, box)
+
+	if !box.Push(3) {
+		t.Fatalf("expected the refused id to be queued once there is room")
+	}
+}
+
+func TestOutboxBatchesWithinInterval(t *testing.T) {
+	nbr := &flakyNbr{}
+	box := newTestOutbox(t, nbr, Config{GossipInterval: 50 * time.Millisecond})
+
+	for i := 0; i < 10; i++ {
+		box.Push(i)
+	}
+	waitForEmpty(t, box)
+
+	if sent := nbr.sent(); len(sent) != 1 {
+		t.Fatalf("expected ids pushed within the interval to share one batch, got %d", len(sent))
+	}
+}
+
+func TestOutboxFlushesFullBatches(t *testing.T) {
+	nbr := &flakyNbr{}
+	// an interval this long never runs out during the test, so anything
+	// sent was sent because the batch filled up
+	box := newTestOutbox(t, nbr, Config{GossipInterval: time.Hour, MaxBatch: 3})
+
+	box.Push(1)
+	box.Push(2)
+
+	time.Sleep(50 * time.Millisecond)
+	if sent := nbr.sent(); len(sent) != 0 {
+		t.Fatalf("expected a partial batch to wait, got %d sent", len(sent))
+	}
+
+	box.Push(3)
+	waitForEmpty(t, box)
+
+	if sent := nbr.sent(); len(sent) != 1 {
+		t.Fatalf("expected the full batch to be sent once, got %d", len(sent))
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("GOSSIP_INTERVAL", "50ms")
+	t.Setenv("GOSSIP_MAX_BATCH", "20")
+
+	cfg, err := ConfigFromEnv()
+	if err != nil {
+		t.Fatalf("error reading config: %v", err)
+	}
+
+	expected := Config{GossipInterval: 50 * time.Millisecond, MaxBatch: 20}
+	if cfg != expected {
+		t.Fatalf("wrong config. expected %+v, got %+v", expected, cfg)
+	}
+
+	t.Setenv("GOSSIP_MAX_BATCH", "lots")
+	if _, err := ConfigFromEnv(); err == nil {
+		t.Fatalf("expected an error for a malformed GOSSIP_MAX_BATCH")
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import "sync"
+
+type Server struct {
+	msgIds map[int]struct{}
+	mu     sync.RWMutex
+}
+
+func NewServer() *Server {
+	return &Server{
+		msgIds: make(map[int]struct{}),
+	}
+}
+
+// add records i and reports whether it was new, so that only the first
+// delivery of a message is gossiped on.
+func (s *Server) add(i int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.msgIds[i]; ok {
+		return false
+	}
+	s.msgIds[i] = struct{}{}
+
+	return true
+}
+
+// has reports whether i has been recorded.
+func (s *Server) has(i int) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.msgIds[i]
+	return ok
+}
+
+// Msgs returns a copy of every message seen so far.
+func (s *Server) Msgs() []int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	msgs := make([]int, 0, len(s.msgIds))
+	for id := range s.msgIds {
+		msgs = append(msgs, id)
+	}
+
+	return msgs
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestServerAdd(t *testing.T) {
+	s := NewServer()
+
+	if !s.add(1) {
+		t.Fatalf("expected first add of 1 to be new")
+	}
+	if s.add(1) {
+		t.Fatalf("expected second add of 1 not to be new")
+	}
+	if !s.add(2) {
+		t.Fatalf("expected first add of 2 to be new")
+	}
+
+	msgs := s.Msgs()
+	slices.Sort(msgs)
+	if !slices.Equal(msgs, []int{1, 2}) {
+		t.Fatalf("wrong messages. expected %v, got %v", []int{1, 2}, msgs)
+	}
+}
+
+// Run with -race to check that broadcasts and reads don't race.
+func TestServerConcurrentBroadcastAndRead(t *testing.T) {
+	s := NewServer()
+
+	writers := 8
+	perWriter := 1_000
+
+	var wg sync.WaitGroup
+	var newMu sync.Mutex
+	newCount := 0
+
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				// every writer broadcasts the same ids, so each one is only new once
+				if s.add(i) {
+					newMu.Lock()
+					newCount += 1
+					newMu.Unlock()
+				}
+			}
+		}()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				msgs := s.Msgs()
+				// readers own their snapshot and can scribble on it
+				for j := range msgs {
+					msgs[j] = -1
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if newCount != perWriter {
+		t.Fatalf("expected each id to be new exactly once, got %d new adds for %d ids", newCount, perWriter)
+	}
+
+	msgs := s.Msgs()
+	slices.Sort(msgs)
+	for i, id := range msgs {
+		if id != i {
+			t.Fatalf("messages were modified through a snapshot, got %d at %d", id, i)
+		}
+	}
+}
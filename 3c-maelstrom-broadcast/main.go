@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"log"
 
 	"maelstrom-broadcast/server"
@@ -16,12 +17,26 @@ import (
 func main() {
 	n := maelstrom.NewNode()
 	//errorPrint := log.New(os.Stderr, "", 1);
-	s, err := server.New(n)
 
+	cfg, err := server.ConfigFromEnv()
 	if err != nil {
 		panic(err)
 	}
 
+	flag.DurationVar(&cfg.GossipInterval, "gossip-interval", cfg.GossipInterval, "longest a new id waits before being gossiped")
+	flag.IntVar(&cfg.MaxBatch, "max-batch", cfg.MaxBatch, "gossip as soon as this many ids are waiting for a neighbour, 0 to only use the interval")
+	flag.IntVar(&cfg.FanOut, "fan-out", cfg.FanOut, "neighbours to gossip to each interval, 0 for all")
+	flag.StringVar(&cfg.Topology, "topology", cfg.Topology, "maelstrom, star, tree, kary:<k> or grid")
+	flag.Parse()
+
+	s, err := server.New(n, cfg)
+
+	if err != nil {
+		panic(err)
+	}
+
+	n.Handle("init", s.Init)
+
 	n.Handle("broadcast", s.HandleBroadcast)
 
 	n.Handle("read", s.HandleRead)
@@ -30,6 +45,8 @@ func main() {
 
 	n.Handle("gossip", s.HandleGossip)
 
+	n.Handle("gossip_ok", s.HandleGossipOk)
+
 	s.Gossip()
 
 	if err := n.Run(); err != nil {
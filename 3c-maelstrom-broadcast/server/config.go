@@ -0,0 +1,82 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Config tunes how eagerly the server gossips, trading messages per
+// broadcast against how long a broadcast takes to reach every node.
+type Config struct {
+	// GossipInterval is the longest a new id waits before it is sent on.
+	GossipInterval time.Duration
+	// MaxBatch sends ids to a neighbour as soon as this many are waiting for
+	// them, without waiting for the interval. Zero turns this off.
+	MaxBatch int
+	// FanOut is how many neighbours are gossiped to each interval, taking
+	// turns through the list. Zero means all of them.
+	FanOut int
+	// Topology names the topology.Builder that picks our neighbours, in
+	// place of the topology Maelstrom suggests.
+	Topology string
+}
+
+var DefaultConfig = Config{
+	GossipInterval: 200 * time.Millisecond,
+	MaxBatch:       0,
+	FanOut:         0,
+	Topology:       "maelstrom",
+}
+
+// ConfigFromEnv starts from DefaultConfig and overrides it with
+// GOSSIP_INTERVAL, GOSSIP_MAX_BATCH, GOSSIP_FANOUT and GOSSIP_TOPOLOGY when
+// they are set.
+func ConfigFromEnv() (Config, error) {
+	cfg := DefaultConfig
+
+	if val, ok := os.LookupEnv("GOSSIP_INTERVAL"); ok {
+		interval, err := time.ParseDuration(val)
+		if err != nil {
+			return cfg, fmt.Errorf("parse GOSSIP_INTERVAL: %w", err)
+		}
+		cfg.GossipInterval = interval
+	}
+
+	if val, ok := os.LookupEnv("GOSSIP_MAX_BATCH"); ok {
+		maxBatch, err := strconv.Atoi(val)
+		if err != nil {
+			return cfg, fmt.Errorf("parse GOSSIP_MAX_BATCH: %w", err)
+		}
+		cfg.MaxBatch = maxBatch
+	}
+
+	if val, ok := os.LookupEnv("GOSSIP_FANOUT"); ok {
+		fanOut, err := strconv.Atoi(val)
+		if err != nil {
+			return cfg, fmt.Errorf("parse GOSSIP_FANOUT: %w", err)
+		}
+		cfg.FanOut = fanOut
+	}
+
+	if val, ok := os.LookupEnv("GOSSIP_TOPOLOGY"); ok {
+		cfg.Topology = val
+	}
+
+	return cfg, nil
+}
+
+func (c Config) validate() error {
+	if c.GossipInterval <= 0 {
+		return fmt.Errorf("invalid gossip interval %v: must be positive", c.GossipInterval)
+	}
+	if c.MaxBatch < 0 {
+		return fmt.Errorf("invalid max batch %d: cannot be negative", c.MaxBatch)
+	}
+	if c.FanOut < 0 {
+		return fmt.Errorf("invalid fan-out %d: cannot be negative", c.FanOut)
+	}
+
+	return nil
+}
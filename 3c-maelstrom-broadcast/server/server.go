@@ -3,48 +3,159 @@ package server
 import (
 	"encoding/json"
 	"log"
-	"maelstrom-broadcast/snowflake"
-	"os"
+	"maelstrom-shared/logger"
+	"maelstrom-shared/snowflake"
+	"maelstrom-shared/topology"
 	"sync"
 	"time"
 
 	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
 )
 
-type nbrIds map[int]struct{}
+// entry is an id in the gossip log, along with the neighbour we learnt it
+// from so that it isn't gossiped straight back to them.
+type entry struct {
+	id   int
+	from string
+}
 
 type Server struct {
-	n    *maelstrom.Node
-	nbrs []string
+	n       *maelstrom.Node
+	cfg     Config
+	builder topology.Builder
 
 	worker *snowflake.Worker
 
 	idsMu sync.RWMutex
 	ids   map[int]struct{}
-
-	nbrIdsMu sync.RWMutex
-	nbrIds   map[string]nbrIds
+	// entries holds every id in the order we learnt it. It is only ever
+	// appended to, so a neighbour's progress is a single index into it.
+	entries []entry
+
+	nbrsMu sync.RWMutex
+	nbrs   []string
+	// acked maps each neighbour to the length of the prefix of entries they
+	// have acknowledged.
+	acked map[string]int
+	// sent maps each neighbour to the length of the prefix of entries we
+	// have sent them, acknowledged or not.
+	sent map[string]int
+	// turn is where the next interval's fan-out starts in nbrs.
+	turn int
+
+	// flushCh is signalled when new ids may have filled a batch.
+	flushCh chan struct{}
 
 	log *log.Logger
 }
 
-func New(n *maelstrom.Node) (*Server, error) {
-	log := log.New(os.Stderr, "", 1)
-	worker, err := snowflake.NewWorker(int64(os.Getpid()))
+func New(n *maelstrom.Node, cfg Config) (*Server, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	builder, err := topology.ByName(cfg.Topology)
 	if err != nil {
 		return nil, err
 	}
+
+	log := logger.New()
 	ids := make(map[int]struct{})
 
 	return &Server{
-		n:      n,
-		worker: worker,
-		ids:    ids,
-		log:    log,
+		n:       n,
+		cfg:     cfg,
+		builder: builder,
+		ids:     ids,
+		acked:   make(map[string]int),
+		sent:    make(map[string]int),
+		flushCh: make(chan struct{}, 1),
+		log:     log,
 	}, nil
 
 }
 
+func (s *Server) Init(msg maelstrom.Message) error {
+	worker, err := snowflake.NewWorkerForNode(s.n.ID())
+	if err != nil {
+		return err
+	}
+	s.worker = worker
+
+	return nil
+}
+
+// add records id, learnt from the neighbour from, unless we already have it.
+func (s *Server) add(id int, from string) {
+	s.idsMu.Lock()
+	defer s.idsMu.Unlock()
+
+	if _, pres := s.ids[id]; pres {
+		return
+	}
+
+	s.ids[id] = struct{}{}
+	s.entries = append(s.entries, entry{id: id, from: from})
+
+	if s.cfg.MaxBatch > 0 {
+		select {
+		case s.flushCh <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// unacked returns the ids nbr hasn't acknowledged yet, leaving out the ones
+// we learnt from nbr, along with the length of the log they were taken from.
+func (s *Server) unacked(nbr string) ([]int, int) {
+	s.nbrsMu.RLock()
+	start := s.acked[nbr]
+	s.nbrsMu.RUnlock()
+
+	return s.since(nbr, start)
+}
+
+// unsent is like unacked but also leaves out ids already sent to nbr that
+// are still waiting for an acknowledgement.
+func (s *Server) unsent(nbr string) ([]int, int) {
+	s.nbrsMu.RLock()
+	start := max(s.acked[nbr], s.sent[nbr])
+	s.nbrsMu.RUnlock()
+
+	return s.since(nbr, start)
+}
+
+func (s *Server) since(nbr string, start int) ([]int, int) {
+	s.idsMu.RLock()
+	defer s.idsMu.RUnlock()
+
+	ids := make([]int, 0)
+	for _, e := range s.entries[start:] {
+		if e.from != nbr {
+			ids = append(ids, e.id)
+		}
+	}
+
+	return ids, len(s.entries)
+}
+
+// ack records that nbr has every entry before end.
+func (s *Server) ack(nbr string, end int) {
+	s.nbrsMu.Lock()
+	defer s.nbrsMu.Unlock()
+
+	s.acked[nbr] = max(s.acked[nbr], end)
+	s.sent[nbr] = max(s.sent[nbr], end)
+}
+
+// markSent records that every entry before end is on its way to nbr.
+func (s *Server) markSent(nbr string, end int) {
+	s.nbrsMu.Lock()
+	defer s.nbrsMu.Unlock()
+
+	s.sent[nbr] = max(s.sent[nbr], end)
+}
+
 func (s *Server) HandleBroadcast(msg maelstrom.Message) error {
 	var body map[string]any
 	if err := json.Unmarshal(msg.Body, &body); err != nil {
@@ -54,177 +165,175 @@ func (s *Server) HandleBroadcast(msg maelstrom.Message) error {
 	// message field is guaranteed to be an integer
 	msgId := int(body["message"].(float64))
 
-	s.idsMu.Lock()
-	s.ids[msgId] = struct{}{}
-	s.idsMu.Unlock()
+	s.add(msgId, "")
 
 	return s.n.Reply(msg, map[string]any{
 		"type": "broadcast_ok",
 	})
 }
 
+// messages returns a copy of every id we know about.
+func (s *Server) messages() []int {
+	s.idsMu.RLock()
+	defer s.idsMu.RUnlock()
+
+	ids := make([]int, len(s.entries))
+	for i, e := range s.entries {
+		ids[i] = e.id
+	}
+
+	return ids
+}
+
 func (s *Server) HandleRead(msg maelstrom.Message) error {
 	body := make(map[string]any)
 
-	s.idsMu.RLock()
-	ids := make([]int, len(s.ids))
-	i := 0
-	for key := range s.ids {
-		ids[i] = key
-		i += 1
-	}
-	s.idsMu.RUnlock()
-	body["messages"] = ids
+	body["messages"] = s.messages()
 	body["type"] = "read_ok"
 
 	return s.n.Reply(msg, body)
 }
 
-type topologyBody struct {
-	Topology map[string][]string
-}
-
 func (s *Server) HandleTopology(msg maelstrom.Message) error {
-	var body topologyBody
-
-	if err := json.Unmarshal(msg.Body, &body); err != nil {
+	suggested, err := topology.ParseAll(msg.Body)
+	if err != nil {
 		return err
 	}
 
-	topology_nbrs := body.Topology[s.n.ID()]
+	t := s.builder(s.n.NodeIDs(), suggested)
+	s.log.Printf("using %s topology: %+v", s.cfg.Topology, topology.Measure(t))
 
-	nbrs := make([]string, len(topology_nbrs))
+	s.nbrsMu.Lock()
+	s.nbrs = t[s.n.ID()]
+	s.nbrsMu.Unlock()
 
-	for i := 0; i < len(topology_nbrs); i++ {
-		nbrs[i] = topology_nbrs[i]
-	}
+	out := make(map[string]any)
+	out["type"] = "topology_ok"
+
+	return s.n.Reply(msg, out)
+}
 
-	s.nbrs = nbrs
+func (s *Server) neighbours() []string {
+	s.nbrsMu.RLock()
+	defer s.nbrsMu.RUnlock()
 
-	s.nbrIdsMu.Lock()
-	defer s.nbrIdsMu.Unlock()
-	s.nbrIds = make(map[string]nbrIds)
-	for _, nbr := range s.nbrs {
-		s.nbrIds[nbr] = make(nbrIds)
+	return s.nbrs
+}
+
+// nextFanOut returns the neighbours to gossip to this interval, moving on
+// through the list each time so that every neighbour gets a turn.
+func (s *Server) nextFanOut() []string {
+	s.nbrsMu.Lock()
+	defer s.nbrsMu.Unlock()
+
+	if s.cfg.FanOut == 0 || s.cfg.FanOut >= len(s.nbrs) {
+		return s.nbrs
 	}
 
-	out := make(map[string]any)
-	out["type"] = "topology_ok"
+	nbrs := make([]string, s.cfg.FanOut)
+	for i := range nbrs {
+		nbrs[i] = s.nbrs[(s.turn+i)%len(s.nbrs)]
+	}
+	s.turn = (s.turn + s.cfg.FanOut) % len(s.nbrs)
 
-	return s.n.Reply(msg, out)
+	return nbrs
+}
+
+// gossipBody is sent to a neighbour with the ids they haven't acknowledged,
+// along with the length of our log they were taken from.
+type gossipBody struct {
+	Type string `json:"type"`
+	Ids  []int  `json:"ids"`
+	End  int    `json:"end"`
+}
+
+// gossipOkBody acknowledges a gossip message and carries back the ids the
+// sender hasn't acknowledged from us, so one round trip syncs both sides.
+type gossipOkBody struct {
+	Type string `json:"type"`
+	Ids  []int  `json:"ids"`
+	End  int    `json:"end"`
 }
 
 func (s *Server) HandleGossip(msg maelstrom.Message) error {
-	var body struct {
-		Ids []int
-	}
+	var body gossipBody
 
 	if err := json.Unmarshal(msg.Body, &body); err != nil {
 		return err
 	}
 
-	// assume that we never get gossip from the same node at the same time
-	s.nbrIdsMu.Lock()
-	nbrIds := s.nbrIds[msg.Src]
-
-	s.idsMu.Lock()
 	for _, id := range body.Ids {
-		nbrIds[id] = struct{}{}
-		s.ids[id] = struct{}{}
+		s.add(id, msg.Src)
 	}
-	s.idsMu.Unlock()
-	s.nbrIdsMu.Unlock()
-
-	s.idsMu.RLock()
-	s.nbrIdsMu.RLock()
 
-	resIds := make([]int, 0)
-	for id := range s.ids {
-		if _, pres := nbrIds[id]; !pres {
-			resIds = append(resIds, id)
-		}
-	}
-	s.nbrIdsMu.RUnlock()
-	s.idsMu.RUnlock()
+	resIds, _ := s.unacked(msg.Src)
 
-	out := struct {
-		Type string
-		Ids  []int
-	}{
+	// gossip_ok is sent rather than replied so the sender needn't keep a
+	// callback around for acknowledgements that may never arrive
+	return s.n.Send(msg.Src, gossipOkBody{
 		Type: "gossip_ok",
 		Ids:  resIds,
+		End:  body.End,
+	})
+}
+
+func (s *Server) HandleGossipOk(msg maelstrom.Message) error {
+	var body gossipOkBody
+
+	if err := json.Unmarshal(msg.Body, &body); err != nil {
+		return err
 	}
 
-	return s.n.Reply(msg, out)
+	// they know everything before end
+	s.ack(msg.Src, body.End)
+
+	// and they've sent back what they think we're missing
+	for _, id := range body.Ids {
+		s.add(id, msg.Src)
+	}
+
+	return nil
 }
 
+// Gossip starts sending ids on to neighbours in the background. Every
+// interval each neighbour in the fan-out is sent everything it hasn't
+// acknowledged, and in between a neighbour is sent a batch as soon as
+// MaxBatch new ids are waiting for it.
 func (s *Server) Gossip() {
-	ticker := time.NewTicker(200 * time.Millisecond)
+	ticker := time.NewTicker(s.cfg.GossipInterval)
 	go func() {
-		for range ticker.C {
-			for _, nbr := range s.nbrs {
-				// make a list of ids that we don't know that they know
-				// and send it to the nbr
-				newIds := make([]int, 0)
-				s.idsMu.RLock()
-				s.nbrIdsMu.RLock()
-				nbrsIds := s.nbrIds[nbr]
-				for id := range s.ids {
-					if _, pres := nbrsIds[id]; !pres {
-						newIds = append(newIds, id)
-					}
+		for {
+			select {
+			case <-ticker.C:
+				for _, nbr := range s.nextFanOut() {
+					newIds, end := s.unacked(nbr)
+					s.flush(nbr, newIds, end)
 				}
-				s.nbrIdsMu.RUnlock()
-				s.idsMu.RUnlock()
-
-				if len(newIds) > 0 {
-					msg := map[string]any{
-						"type": "gossip",
-						"ids":  newIds,
+			case <-s.flushCh:
+				for _, nbr := range s.neighbours() {
+					newIds, end := s.unsent(nbr)
+					if len(newIds) >= s.cfg.MaxBatch {
+						s.flush(nbr, newIds, end)
 					}
-
-					s.n.RPC(nbr, msg, s.gossip(nbr, newIds))
 				}
 			}
 		}
 	}()
 }
 
-func (s *Server) gossip(nbr string, sentIds []int) func(msg maelstrom.Message) error {
-	return func(msg maelstrom.Message) error {
-		var body struct {
-			Messages []int
-		}
-
-		// if we have a response we know that they know about the sentIds
-		s.nbrIdsMu.Lock()
-		for _, id := range sentIds {
-			s.nbrIds[nbr][id] = struct{}{}
-		}
-		s.nbrIdsMu.Unlock()
-
-		if err := json.Unmarshal(msg.Body, &body); err != nil {
-			return err
-		}
-
-		// update our list of ids with the response that we get
-		s.idsMu.RLock()
-		currIds := s.ids
-		newIds := make([]int, 0)
-
-		for _, id := range body.Messages {
-			if _, pres := currIds[id]; !pres {
-				newIds = append(newIds, id)
-			}
-		}
-		s.idsMu.RUnlock()
-
-		s.idsMu.Lock()
-		for _, msg := range newIds {
-			s.ids[msg] = struct{}{}
-		}
-		s.idsMu.Unlock()
+func (s *Server) flush(nbr string, newIds []int, end int) {
+	if len(newIds) == 0 {
+		// everything left came from them, so they already know it
+		s.ack(nbr, end)
+		return
+	}
 
-		return nil
+	s.markSent(nbr, end)
+	if err := s.n.Send(nbr, gossipBody{
+		Type: "gossip",
+		Ids:  newIds,
+		End:  end,
+	}); err != nil {
+		s.log.Printf("error gossiping to %s: %v", nbr, err)
 	}
 }
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+func TestServerUnackedSkipsSender(t *testing.T) {
+	n := maelstrom.NewNode()
+	n.Init("n0", []string{"n0", "n1", "n2"})
+	s, _ := New(n, DefaultConfig)
+
+	s.add(1, "")
+	s.add(2, "n1")
+	s.add(3, "n2")
+	s.add(2, "n2")
+
+	tests := []struct {
+		nbr      string
+		expected []int
+	}{
+		{nbr: "n1", expected: []int{1, 3}},
+		{nbr: "n2", expected: []int{1, 2}},
+	}
+
+	for _, tt := range tests {
+		ids, end := s.unacked(tt.nbr)
+		if !slices.Equal(ids, tt.expected) {
+			t.Fatalf("wrong unacked ids for %s. expected %v, got %v", tt.nbr, tt.expected, ids)
+		}
+		if end != 3 {
+			t.Fatalf("wrong end of log. expected %d, got %d", 3, end)
+		}
+	}
+
+	s.ack("n1", 2)
+	ids, _ := s.unacked("n1")
+	if !slices.Equal(ids, []int{3}) {
+		t.Fatalf("expected only the ids after the ack, got %v", ids)
+	}
+
+	s.ack("n1", 1)
+	if ids, _ := s.unacked("n1"); !slices.Equal(ids, []int{3}) {
+		t.Fatalf("expected an older ack not to move progress back, got %v", ids)
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("GOSSIP_INTERVAL", "50ms")
+	t.Setenv("GOSSIP_MAX_BATCH", "20")
+	t.Setenv("GOSSIP_FANOUT", "3")
+	t.Setenv("GOSSIP_TOPOLOGY", "kary:4")
+
+	cfg, err := ConfigFromEnv()
+	if err != nil {
+		t.Fatalf("error reading config: %v", err)
+	}
+
+	expected := Config{GossipInterval: 50 * time.Millisecond, MaxBatch: 20, FanOut: 3, Topology: "kary:4"}
+	if cfg != expected {
+		t.Fatalf("wrong config. expected %+v, got %+v", expected, cfg)
+	}
+
+	t.Setenv("GOSSIP_MAX_BATCH", "lots")
+	if _, err := ConfigFromEnv(); err == nil {
+		t.Fatalf("expected an error for a malformed GOSSIP_MAX_BATCH")
+	}
+}
+
+func TestServerFanOutTakesTurns(t *testing.T) {
+	n := maelstrom.NewNode()
+	n.Init("n0", []string{"n0", "n1", "n2", "n3"})
+	s, _ := New(n, Config{GossipInterval: time.Second, FanOut: 2, Topology: "maelstrom"})
+	s.nbrs = []string{"n1", "n2", "n3"}
+
+	expected := [][]string{
+		{"n1", "n2"},
+		{"n3", "n1"},
+		{"n2", "n3"},
+	}
+	for _, nbrs := range expected {
+		if actual := s.nextFanOut(); !slices.Equal(actual, nbrs) {
+			t.Fatalf("wrong fan-out. expected %v, got %v", nbrs, actual)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"maelstrom-shared/simulator"
+	"slices"
+	"sort"
+	"testing"
+	"time"
+)
+
+// newSimulatedBroadcast runs a server per node on a simulated network. The
+// servers don't gossip until the test starts them.
+func newSimulatedBroadcast(t *testing.T, ctx context.Context, nodeIds []string, netCfg simulator.Config, cfg Config) (*simulator.Network, map[string]*Server) {
+	net := simulator.New(nodeIds, netCfg)
+
+	servers := make(map[string]*Server)
+	for _, id := range nodeIds {
+		n := net.Node(id)
+
+		s, err := New(n, cfg)
+		if err != nil {
+			t.Fatalf("error creating server: %v", err)
+		}
+		servers[id] = s
+
+		n.Handle("init", s.Init)
+		n.Handle("broadcast", s.HandleBroadcast)
+		n.Handle("read", s.HandleRead)
+		n.Handle("topology", s.HandleTopology)
+		n.Handle("gossip", s.HandleGossip)
+		n.Handle("gossip_ok", s.HandleGossipOk)
+	}
+
+	if err := net.Start(ctx); err != nil {
+		t.Fatalf("error starting network: %v", err)
+	}
+	t.Cleanup(net.Stop)
+
+	return net, servers
+}
+
+// sendTopology hands every node the suggested topology.
+func sendTopology(t *testing.T, ctx context.Context, net *simulator.Network, topology map[string][]string) {
+	for id := range topology {
+		if _, err := net.RPC(ctx, id, map[string]any{"type": "topology", "topology": topology}); err != nil {
+			t.Fatalf("error sending topology to %s: %v", id, err)
+		}
+	}
+}
+
+func broadcast(t *testing.T, ctx context.Context, net *simulator.Network, id string, message int) {
+	if _, err := net.RPC(ctx, id, map[string]any{"type": "broadcast", "message": message}); err != nil {
+		t.Fatalf("error broadcasting %d: %v", message, err)
+	}
+}
+
+// readAll returns every id the node has seen, in order.
+func readAll(t *testing.T, ctx context.Context, net *simulator.Network, id string) []int {
+	res, err := net.RPC(ctx, id, map[string]any{"type": "read"})
+	if err != nil {
+		t.Fatalf("error reading from %s: %v", id, err)
+	}
+
+	var body struct {
+		Messages []int
+	}
+	if err := json.Unmarshal(res.Body, &body); err != nil {
+		t.Fatalf("error unmarshalling read_ok: %v", err)
+	}
+
+	sort.Ints(body.Messages)
+	return body.Messages
+}
+
+// waitForMessages reads from the node until it has seen exactly expected.
+func waitForMessages(t *testing.T, ctx context.Context, net *simulator.Network, id string, expected []int) {
+	for {
+		msgs := readAll(t, ctx, net, id)
+		if slices.Equal(msgs, expected) {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			t.Fatalf("expected %s to have %v, got %v", id, expected, msgs)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestServerGossipConverges(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	nodeIds := []string{"n0", "n1"}
+	net, servers := newSimulatedBroadcast(t, ctx, nodeIds, simulator.Config{Seed: 1}, DefaultConfig)
+
+	sendTopology(t, ctx, net, map[string][]string{
+		"n0": {"n1"},
+		"n1": {"n0"},
+	})
+
+	expected := make([]int, 0)
+	for i := 0; i < 10; i++ {
+		broadcast(t, ctx, net, nodeIds[i%2], i)
+		expected = append(expected, i)
+	}
+
+	// only n0 gossips, so n1's ids can only reach n0 through the gossip_ok
+	// replies
+	servers["n0"].Gossip()
+
+	for _, id := range nodeIds {
+		waitForMessages(t, ctx, net, id, expected)
+	}
+}
+
+func TestServerFlushesFullBatches(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// an interval this long never fires during the test, so anything that
+	// arrives was sent because a batch filled up
+	cfg := Config{GossipInterval: time.Hour, MaxBatch: 2, Topology: "maelstrom"}
+
+	nodeIds := []string{"n0", "n1"}
+	net, servers := newSimulatedBroadcast(t, ctx, nodeIds, simulator.Config{Seed: 1}, cfg)
+
+	sendTopology(t, ctx, net, map[string][]string{
+		"n0": {"n1"},
+		"n1": {"n0"},
+	})
+	for _, s := range servers {
+		s.Gossip()
+	}
+
+	broadcast(t, ctx, net, "n0", 1)
+
+	// a single id is less than a batch so it should stay put
+	time.Sleep(100 * time.Millisecond)
+	if ids := readAll(t, ctx, net, "n1"); len(ids) != 0 {
+		t.Fatalf("expected n1 not to have been sent a partial batch, got %v", ids)
+	}
+
+	broadcast(t, ctx, net, "n0", 2)
+	waitForMessages(t, ctx, net, "n1", []int{1, 2})
+}
+
+func TestServerBuildsOwnTopology(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cfg := DefaultConfig
+	cfg.Topology = "star"
+
+	nodeIds := []string{"n0", "n1", "n2", "n3"}
+	net, servers := newSimulatedBroadcast(t, ctx, nodeIds, simulator.Config{Seed: 1}, cfg)
+
+	// the suggested topology is ignored in favour of a star around n0
+	sendTopology(t, ctx, net, map[string][]string{
+		"n0": {"n1"},
+		"n1": {"n0", "n2"},
+		"n2": {"n1", "n3"},
+		"n3": {"n2"},
+	})
+
+	expected := []string{"n1", "n2", "n3"}
+	if nbrs := servers["n0"].neighbours(); !slices.Equal(nbrs, expected) {
+		t.Fatalf("wrong neighbours. expected %v, got %v", expected, nbrs)
+	}
+}
+
+func TestSimulatedBroadcastSurvivesPartition(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	nodeIds := []string{"n0", "n1", "n2", "n3", "n4"}
+	net, servers := newSimulatedBroadcast(t, ctx, nodeIds, simulator.Config{
+		Latency:  2 * time.Millisecond,
+		Jitter:   3 * time.Millisecond,
+		DropRate: 0.1,
+		Seed:     1,
+	}, Config{GossipInterval: 10 * time.Millisecond, Topology: "maelstrom"})
+
+	for _, s := range servers {
+		s.Gossip()
+	}
+
+	// a line, so that every id has to be passed along
+	sendTopology(t, ctx, net, map[string][]string{
+		"n0": {"n1"},
+		"n1": {"n0", "n2"},
+		"n2": {"n1", "n3"},
+		"n3": {"n2", "n4"},
+		"n4": {"n3"},
+	})
+
+	net.Partition([]string{"n0", "n1"}, []string{"n2", "n3", "n4"})
+
+	expected := make([]int, 0)
+	for i := 0; i < 20; i++ {
+		broadcast(t, ctx, net, nodeIds[i%len(nodeIds)], i)
+		expected = append(expected, i)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if stats := net.Stats(); stats.Partitioned == 0 {
+		t.Fatalf("expected gossip to be cut off by the partition, got %+v", stats)
+	}
+	net.Heal()
+
+	for _, id := range nodeIds {
+		waitForMessages(t, ctx, net, id, expected)
+	}
+}
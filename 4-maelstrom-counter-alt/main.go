@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"log"
 
 	"maelstrom-counter-alt/server"
@@ -12,19 +13,39 @@ func main() {
 	n := maelstrom.NewNode()
 	kv := maelstrom.NewSeqKV(n)
 
-	s, err := server.New(n, kv)
+	cfg, err := server.ConfigFromEnv()
+	if err != nil {
+		panic(err)
+	}
+
+	flag.StringVar(&cfg.Sync, "sync", cfg.Sync, "kv to sync through seq-kv, gossip to send counts between nodes")
+	flag.DurationVar(&cfg.Interval, "interval", cfg.Interval, "how often to refresh or gossip counts")
+	flag.BoolVar(&cfg.Durable, "durable", cfg.Durable, "also write counts to seq-kv when gossiping")
+	flag.BoolVar(&cfg.Session, "session", cfg.Session, "reply with version vectors and make reads catch up with the one a client sends")
+	flag.DurationVar(&cfg.SessionTimeout, "session-timeout", cfg.SessionTimeout, "how long a session read waits to catch up")
+	flag.Parse()
+
+	s, err := server.New(n, kv, cfg)
 
 	if err != nil {
 		panic(err)
 	}
 
-	n.Handle("init", s.Init)
+	n.Handle("init", func(msg maelstrom.Message) error {
+		if err := s.Init(msg); err != nil {
+			return err
+		}
+
+		// syncing needs the node's id and its peers, which init sets
+		s.Sync()
+		return nil
+	})
 
 	n.Handle("read", s.HandleRead)
 
 	n.Handle("add", s.HandleAdd)
 
-	s.RefreshCache()
+	n.Handle("gossip", s.HandleGossip)
 
 	if err := n.Run(); err != nil {
 		log.Fatal(err)
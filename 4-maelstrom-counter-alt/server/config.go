@@ -0,0 +1,108 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	// SyncKV has every node write its count to the kv store and read
+	// everyone else's back each interval.
+	SyncKV = "kv"
+	// SyncGossip has nodes send their whole PN-counter to each other each
+	// interval, merging with an element-wise max.
+	SyncGossip = "gossip"
+)
+
+// Config picks how nodes learn about each other's adds.
+type Config struct {
+	// Sync is SyncKV or SyncGossip.
+	Sync string
+	// Interval is how often the cache is refreshed or gossiped.
+	Interval time.Duration
+	// Durable also writes our count to the kv store when gossiping. It is
+	// always on in SyncKV mode.
+	Durable bool
+	// Session puts a version vector on every reply and makes reads wait
+	// until our view dominates the one a client sends back, so a client
+	// never sees its own writes undone or the counter go back.
+	Session bool
+	// SessionTimeout is how long a read waits before giving up with a
+	// temporarily-unavailable error.
+	SessionTimeout time.Duration
+}
+
+var DefaultConfig = Config{
+	Sync:     SyncKV,
+	Interval: 100 * time.Millisecond,
+	Durable:  false,
+
+	Session:        false,
+	SessionTimeout: time.Second,
+}
+
+// ConfigFromEnv starts from DefaultConfig and overrides it with
+// COUNTER_SYNC, COUNTER_INTERVAL, COUNTER_DURABLE, COUNTER_SESSION and
+// COUNTER_SESSION_TIMEOUT when they are set.
+func ConfigFromEnv() (Config, error) {
+	cfg := DefaultConfig
+
+	if val, ok := os.LookupEnv("COUNTER_SYNC"); ok {
+		cfg.Sync = val
+	}
+
+	if val, ok := os.LookupEnv("COUNTER_INTERVAL"); ok {
+		interval, err := time.ParseDuration(val)
+		if err != nil {
+			return cfg, fmt.Errorf("parse COUNTER_INTERVAL: %w", err)
+		}
+		cfg.Interval = interval
+	}
+
+	if val, ok := os.LookupEnv("COUNTER_DURABLE"); ok {
+		durable, err := strconv.ParseBool(val)
+		if err != nil {
+			return cfg, fmt.Errorf("parse COUNTER_DURABLE: %w", err)
+		}
+		cfg.Durable = durable
+	}
+
+	if val, ok := os.LookupEnv("COUNTER_SESSION"); ok {
+		session, err := strconv.ParseBool(val)
+		if err != nil {
+			return cfg, fmt.Errorf("parse COUNTER_SESSION: %w", err)
+		}
+		cfg.Session = session
+	}
+
+	if val, ok := os.LookupEnv("COUNTER_SESSION_TIMEOUT"); ok {
+		timeout, err := time.ParseDuration(val)
+		if err != nil {
+			return cfg, fmt.Errorf("parse COUNTER_SESSION_TIMEOUT: %w", err)
+		}
+		cfg.SessionTimeout = timeout
+	}
+
+	return cfg, nil
+}
+
+// usesKV reports whether our count is written to the kv store.
+func (c Config) usesKV() bool {
+	return c.Sync == SyncKV || c.Durable
+}
+
+func (c Config) validate() error {
+	if c.Sync != SyncKV && c.Sync != SyncGossip {
+		return fmt.Errorf("unknown sync mode %q: expected %q or %q", c.Sync, SyncKV, SyncGossip)
+	}
+	if c.Interval <= 0 {
+		return fmt.Errorf("invalid interval %v: must be positive", c.Interval)
+	}
+	if c.Session && c.SessionTimeout <= 0 {
+		return fmt.Errorf("invalid session timeout %v: must be positive", c.SessionTimeout)
+	}
+
+	return nil
+}
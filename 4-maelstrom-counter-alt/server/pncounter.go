@@ -0,0 +1,90 @@
+package server
+
+// PNCounter is a counter CRDT that can go down as well as up. Every node has
+// its own slot in two grow-only counters, P for increments and N for
+// decrements, and the value is the sum of P less the sum of N. Only a node
+// changes its own slots and they never shrink, so merging is an element-wise
+// max, which is commutative, associative and idempotent.
+type PNCounter struct {
+	P map[string]int `json:"p"`
+	N map[string]int `json:"n"`
+}
+
+func NewPNCounter() PNCounter {
+	return PNCounter{
+		P: make(map[string]int),
+		N: make(map[string]int),
+	}
+}
+
+// Add records delta against node, in P if it's positive and in N if it's
+// negative.
+func (c PNCounter) Add(node string, delta int) {
+	if delta > 0 {
+		c.P[node] += delta
+	} else if delta < 0 {
+		c.N[node] -= delta
+	}
+}
+
+// Merge takes the element-wise max of other into c.
+func (c PNCounter) Merge(other PNCounter) {
+	mergeMax(c.P, other.P)
+	mergeMax(c.N, other.N)
+}
+
+func mergeMax(into, from map[string]int) {
+	for node, count := range from {
+		if count > into[node] {
+			into[node] = count
+		}
+	}
+}
+
+func (c PNCounter) Value() int {
+	sum := 0
+
+	for _, count := range c.P {
+		sum += count
+	}
+	for _, count := range c.N {
+		sum -= count
+	}
+
+	return sum
+}
+
+// Version returns c's version vector: how many increments and decrements
+// each node has made, by size, kept apart. Each component only ever grows,
+// so a counter that has seen a superset of another's adds has a version that
+// dominates it. P and N stay separate components because they can be
+// learnt separately, and a stale P next to a fresh N must not pass for a
+// newer view.
+func (c PNCounter) Version() PNCounter {
+	return c.Clone()
+}
+
+// Dominates reports whether c has seen every add that version has, in both
+// its increments and its decrements.
+func (c PNCounter) Dominates(version PNCounter) bool {
+	for node, count := range version.P {
+		if c.P[node] < count {
+			return false
+		}
+	}
+	for node, count := range version.N {
+		if c.N[node] < count {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Clone returns a copy of c that shares nothing with it.
+func (c PNCounter) Clone() PNCounter {
+	clone := NewPNCounter()
+	clone.Merge(c)
+
+	return clone
+}
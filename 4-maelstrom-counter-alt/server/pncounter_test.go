@@ -0,0 +1,169 @@
+package server
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// randomCounters builds count counters that could all have come from the same
+// run: each is a random prefix of every node's history of adds.
+func randomCounters(r *rand.Rand, count int) []PNCounter {
+	nodes := []string{"n0", "n1", "n2", "n3"}
+
+	history := make(map[string][]int)
+	for _, node := range nodes {
+		for i := r.Intn(10); i > 0; i-- {
+			history[node] = append(history[node], r.Intn(21)-10)
+		}
+	}
+
+	counters := make([]PNCounter, count)
+	for i := range counters {
+		counters[i] = NewPNCounter()
+		for _, node := range nodes {
+			for _, delta := range history[node][:r.Intn(len(history[node])+1)] {
+				counters[i].Add(node, delta)
+			}
+		}
+	}
+
+	return counters
+}
+
+func merged(counters ...PNCounter) PNCounter {
+	c := NewPNCounter()
+	for _, other := range counters {
+		c.Merge(other)
+	}
+
+	return c
+}
+
+func TestPNCounterAdd(t *testing.T) {
+	c := NewPNCounter()
+	c.Add("n0", 5)
+	c.Add("n0", -3)
+	c.Add("n1", -4)
+	c.Add("n1", 0)
+
+	if val := c.Value(); val != -2 {
+		t.Fatalf("expected value to be %d, got %d", -2, val)
+	}
+	if c.P["n0"] != 5 || c.N["n0"] != 3 || c.N["n1"] != 4 {
+		t.Fatalf("expected increments and decrements to be kept apart, got %+v", c)
+	}
+}
+
+func TestPNCounterMergeCommutative(t *testing.T) {
+	for seed := int64(0); seed < 200; seed++ {
+		r := rand.New(rand.NewSource(seed))
+		cs := randomCounters(r, 2)
+
+		ab, ba := merged(cs[0], cs[1]), merged(cs[1], cs[0])
+		if !reflect.DeepEqual(ab, ba) {
+			t.Fatalf("seed %d: expected a+b == b+a, got %+v and %+v", seed, ab, ba)
+		}
+	}
+}
+
+func TestPNCounterMergeAssociative(t *testing.T) {
+	for seed := int64(0); seed < 200; seed++ {
+		r := rand.New(rand.NewSource(seed))
+		cs := randomCounters(r, 3)
+
+		left := merged(merged(cs[0], cs[1]), cs[2])
+		right := merged(cs[0], merged(cs[1], cs[2]))
+		if !reflect.DeepEqual(left, right) {
+			t.Fatalf("seed %d: expected (a+b)+c == a+(b+c), got %+v and %+v", seed, left, right)
+		}
+	}
+}
+
+func TestPNCounterMergeIdempotent(t *testing.T) {
+	for seed := int64(0); seed < 200; seed++ {
+		r := rand.New(rand.NewSource(seed))
+		cs := randomCounters(r, 2)
+
+		once := merged(cs[0], cs[1])
+		twice := merged(cs[0], cs[1], cs[1], cs[0])
+		if !reflect.DeepEqual(once, twice) {
+			t.Fatalf("seed %d: expected merging again to change nothing, got %+v and %+v", seed, once, twice)
+		}
+	}
+}
+
+func TestPNCounterMergeOrderConverges(t *testing.T) {
+	for seed := int64(0); seed < 100; seed++ {
+		t.Run(fmt.Sprintf("seed=%d", seed), func(t *testing.T) {
+			r := rand.New(rand.NewSource(seed))
+			cs := randomCounters(r, 5)
+			expected := merged(cs...)
+
+			for i := 0; i < 20; i++ {
+				// merge in a random order, repeating some counters along the way
+				order := r.Perm(len(cs))
+				order = append(order, r.Intn(len(cs)), r.Intn(len(cs)))
+
+				c := NewPNCounter()
+				for _, j := range order {
+					c.Merge(cs[j])
+				}
+
+				if !reflect.DeepEqual(c, expected) || c.Value() != expected.Value() {
+					t.Fatalf("expected merging in order %v to give %+v, got %+v", order, expected, c)
+				}
+			}
+		})
+	}
+}
+
+func TestPNCounterCloneIsIndependent(t *testing.T) {
+	c := NewPNCounter()
+	c.Add("n0", 1)
+
+	clone := c.Clone()
+	clone.Add("n0", 1)
+	clone.Add("n1", -1)
+
+	if val := c.Value(); val != 1 {
+		t.Fatalf("expected changes to the clone to leave the original alone, got %d", val)
+	}
+}
+
+func TestPNCounterVersionDominates(t *testing.T) {
+	c := NewPNCounter()
+	c.Add("n0", 2)
+	c.Add("n0", -1)
+
+	version := c.Version()
+	if version.P["n0"] != 2 || version.N["n0"] != 1 {
+		t.Fatalf("expected n0's version to be P=%d N=%d, got %+v", 2, 1, version)
+	}
+
+	other := c.Clone()
+	other.Add("n1", 1)
+
+	if !other.Dominates(version) {
+		t.Fatalf("expected %+v to dominate %+v", other, version)
+	}
+	if c.Dominates(other.Version()) {
+		t.Fatalf("expected %+v not to dominate %+v", c, other.Version())
+	}
+	if !c.Dominates(PNCounter{}) {
+		t.Fatalf("expected every counter to dominate an empty version")
+	}
+}
+
+// TestPNCounterDominatesStaleIncrements covers a view that has caught up on
+// a node's decrements but not its increments. Its P+N matches the version's,
+// but it would read 5 lower, so it must not count as caught up.
+func TestPNCounterDominatesStaleIncrements(t *testing.T) {
+	version := PNCounter{P: map[string]int{"n1": 5}, N: map[string]int{}}
+	view := PNCounter{P: map[string]int{"n1": 0}, N: map[string]int{"n1": 5}}
+
+	if view.Dominates(version) {
+		t.Fatalf("expected a stale P next to a fresh N not to dominate %+v", version)
+	}
+}
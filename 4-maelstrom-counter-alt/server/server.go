@@ -5,7 +5,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
-	"os"
+	"maelstrom-shared/kv"
+	"maelstrom-shared/logger"
 	"sync"
 	"time"
 
@@ -19,27 +20,50 @@ const (
 
 type nbrIds map[int]struct{}
 
+// pKey and nKey are where node's increments and decrements are kept in the
+// kv store.
+func pKey(node string) string {
+	return node + "_p"
+}
+
+func nKey(node string) string {
+	return node + "_n"
+}
+
 type Server struct {
-	n  *maelstrom.Node
-	kv *maelstrom.KV
+	n   *maelstrom.Node
+	kv  kv.KV
+	cfg Config
 
 	log *log.Logger
 
-	localCache map[string]int
-	muCache    sync.Mutex
+	localCache PNCounter
+	// barriers counts the barriers written, so each has a fresh value
+	barriers int
+	muCache  sync.Mutex
+
+	// muWrite is held while one of our counts is written to the kv store,
+	// so that an older count can't land after a newer one. Reads and adds
+	// only need muCache and never wait on the kv store.
+	muWrite sync.Mutex
 }
 
-func New(n *maelstrom.Node, kv *maelstrom.KV) (*Server, error) {
-	log := log.New(
-		os.Stderr,
-		"",
-		log.Ldate|log.Ltime|log.Lmicroseconds,
-	)
+func New(n *maelstrom.Node, kv kv.KV, cfg Config) (*Server, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	if cfg.usesKV() && kv == nil {
+		return nil, fmt.Errorf("%s sync needs a kv store", cfg.Sync)
+	}
+
+	log := logger.New()
 
 	return &Server{
-		n:   n,
-		kv:  kv,
-		log: log,
+		n:          n,
+		kv:         kv,
+		cfg:        cfg,
+		log:        log,
+		localCache: NewPNCounter(),
 	}, nil
 
 }
@@ -50,31 +74,155 @@ func (s *Server) Init(msg maelstrom.Message) error {
 		return fmt.Errorf("unmarshal init message body: %w", err)
 	}
 
-	s.localCache = make(map[string]int)
-	for _, id := range body.NodeIDs {
-		s.localCache[id] = 0
+	if !s.cfg.usesKV() {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), kvTimeout)
+	defer cancel()
+
+	// a restarted node carries on from the counts it wrote before
+	p, err := s.restoreCount(ctx, pKey(body.NodeID))
+	if err != nil {
+		return err
+	}
+	n, err := s.restoreCount(ctx, nKey(body.NodeID))
+	if err != nil {
+		return err
+	}
+
+	s.merge(PNCounter{
+		P: map[string]int{body.NodeID: p},
+		N: map[string]int{body.NodeID: n},
+	})
+
+	return nil
+}
+
+// restoreCount reads one of our counts from the kv store, creating the key
+// as 0 if it isn't there yet.
+func (s *Server) restoreCount(ctx context.Context, key string) (int, error) {
+	count, err := s.kv.ReadInt(ctx, key)
+	if maelstrom.ErrorCode(err) != maelstrom.KeyDoesNotExist {
+		return count, err
+	}
+
+	err = s.kv.CompareAndSwap(ctx, key, 0, 0, true)
+	if maelstrom.ErrorCode(err) == maelstrom.PreconditionFailed {
+		// seq-kv handed us a stale miss, the key has been written since
+		return s.kv.ReadInt(ctx, key)
 	}
 
-	ctx := context.TODO()
-	return s.kv.CompareAndSwap(ctx, body.NodeID, 0, 0, true)
+	return 0, err
 }
 
 type ReadMSg struct {
 	Type string
+	// Version is the last version vector the client saw, if any.
+	Version PNCounter
 }
 
+// kvTimeout is how long we wait on the kv store when a client or another
+// node is waiting on us.
+const kvTimeout = time.Second
+
+// sessionPoll is how long a session read waits between checks that our view
+// has caught up.
+const sessionPoll = 10 * time.Millisecond
+
 func (s *Server) HandleRead(msg maelstrom.Message) error {
-	val := s.getCounter()
+	var body ReadMSg
+
+	if err := json.Unmarshal(msg.Body, &body); err != nil {
+		return err
+	}
+
+	if !s.cfg.Session {
+		val := s.getCounter()
+
+		s.log.Printf("value in counter is %d", val)
+		out := map[string]any{
+			"type":  "read_ok",
+			"value": val,
+		}
+
+		return s.n.Reply(msg, out)
+	}
 
-	s.log.Printf("value in counter is %d", val)
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.SessionTimeout)
+	defer cancel()
+
+	view, err := s.catchUp(ctx, body.Version)
+	if err != nil {
+		return err
+	}
+
+	s.log.Printf("value in counter is %d at %v", view.Value(), view.Version())
 	out := map[string]any{
-		"type":  "read_ok",
-		"value": val,
+		"type":    "read_ok",
+		"value":   view.Value(),
+		"version": view.Version(),
 	}
 
 	return s.n.Reply(msg, out)
 }
 
+// catchUp waits until our view dominates version and returns it. Syncing
+// through the kv store we don't wait for the next refresh but force one
+// straight away behind a barrier; gossiping we wait for it to arrive.
+func (s *Server) catchUp(ctx context.Context, version PNCounter) (PNCounter, error) {
+	for {
+		view := s.counts()
+		if view.Dominates(version) {
+			return view, nil
+		}
+
+		if s.cfg.Sync == SyncKV {
+			if err := s.barrier(ctx); err != nil {
+				s.log.Printf("error forcing a read for version %v: %v\n", version, err)
+			} else {
+				s.refresh(ctx)
+				if view = s.counts(); view.Dominates(version) {
+					return view, nil
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return view, maelstrom.NewRPCError(maelstrom.TemporarilyUnavailable,
+				fmt.Sprintf("have not caught up with version %v, at %v", version, view.Version()))
+		case <-time.After(sessionPoll):
+		}
+	}
+}
+
+// barrier writes a fresh value to our barrier key and reads it back. seq-kv
+// orders our reads after our writes, so once we see it the reads that
+// follow are at least as new as every write that came before it.
+func (s *Server) barrier(ctx context.Context) error {
+	key := "barrier_" + s.n.ID()
+
+	s.muCache.Lock()
+	s.barriers++
+	token := s.barriers
+	s.muCache.Unlock()
+
+	if err := s.kv.Write(ctx, key, token); err != nil {
+		return err
+	}
+
+	val, err := s.kv.ReadInt(ctx, key)
+	if err != nil {
+		return err
+	}
+	if val < token {
+		return fmt.Errorf("read barrier %d back as %d", token, val)
+	}
+
+	return nil
+}
+
 type AddMsg struct {
 	Type  string
 	Delta int
@@ -89,57 +237,182 @@ func (s *Server) HandleAdd(msg maelstrom.Message) error {
 
 	if body.Delta != 0 {
 		s.muCache.Lock()
-		s.localCache[s.n.ID()] += body.Delta
-		ctx := context.TODO()
-		s.kv.Write(ctx, s.n.ID(), s.localCache[s.n.ID()])
+		s.localCache.Add(s.n.ID(), body.Delta)
 		s.muCache.Unlock()
+
+		if s.cfg.usesKV() {
+			s.writeCount(context.Background(), body.Delta > 0)
+		}
 	}
 
-	out := map[string]string{
+	out := map[string]any{
 		"type": "add_ok",
 	}
+	if s.cfg.Session {
+		// the client's next read has to include this add, wherever it goes
+		out["version"] = s.counts().Version()
+	}
 
 	return s.n.Reply(msg, out)
 }
 
+// Sync starts keeping the cache up to date in the background, the way the
+// config's Sync mode asks for.
+func (s *Server) Sync() {
+	if s.cfg.Sync == SyncGossip {
+		s.Gossip()
+		return
+	}
+
+	s.RefreshCache()
+}
+
 func (s *Server) RefreshCache() {
-	ticker := time.NewTicker(100 * time.Millisecond)
+	ticker := time.NewTicker(s.cfg.Interval)
 	go func() {
 		for range ticker.C {
-			ctx := context.TODO()
-			selfId := s.n.ID()
+			s.refresh(context.TODO())
+		}
+	}()
+}
 
-			newValues := make(map[string]int)
-			for _, node := range s.n.NodeIDs() {
-				if node == selfId {
-					continue
-				}
+// refresh pulls every other node's counts from the kv store and merges them
+// into the cache. seq-kv may hand back stale values, so counts are merged
+// with a max and never go back, and a node we can't read is left as it is
+// rather than dropped to 0. It also puts back our own counts if the kv store
+// is missing some, so adds whose writes were lost in a partition reach the
+// other nodes once it heals.
+func (s *Server) refresh(ctx context.Context) {
+	selfId := s.n.ID()
 
-				val, err := s.kv.ReadInt(ctx, node)
-				if err != nil {
-					s.log.Printf("error reading node: [%s] in CommitAdds: %v\n", node, err)
-				}
-				newValues[node] = val
-			}
+	newValues := NewPNCounter()
+	for _, node := range s.n.NodeIDs() {
+		p, err := s.kv.ReadInt(ctx, pKey(node))
+		if err != nil {
+			s.log.Printf("error reading node: [%s] in refresh: %v\n", node, err)
+			continue
+		}
 
-			s.muCache.Lock()
-			for node, val := range newValues {
-				s.localCache[node] = val
-			}
-			s.muCache.Unlock()
+		n, err := s.kv.ReadInt(ctx, nKey(node))
+		if err != nil {
+			s.log.Printf("error reading node: [%s] in refresh: %v\n", node, err)
+			continue
+		}
+
+		newValues.P[node] = p
+		newValues.N[node] = n
+	}
+
+	s.muCache.Lock()
+	p, pres := newValues.P[selfId]
+	staleP := pres && p < s.localCache.P[selfId]
+	n, pres := newValues.N[selfId]
+	staleN := pres && n < s.localCache.N[selfId]
+	s.localCache.Merge(newValues)
+	s.muCache.Unlock()
+
+	if staleP {
+		s.writeCount(ctx, true)
+	}
+	if staleN {
+		s.writeCount(ctx, false)
+	}
+}
+
+// writeCount writes our increments, or our decrements if positive is false,
+// to the kv store. The count is copied when the write goes out rather than
+// when it was asked for, so whichever write lands last carries the latest
+// count.
+func (s *Server) writeCount(ctx context.Context, positive bool) {
+	s.muWrite.Lock()
+	defer s.muWrite.Unlock()
+
+	selfId := s.n.ID()
+
+	s.muCache.Lock()
+	key, count := nKey(selfId), s.localCache.N[selfId]
+	if positive {
+		key, count = pKey(selfId), s.localCache.P[selfId]
+	}
+	s.muCache.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, kvTimeout)
+	defer cancel()
+
+	if err := s.kv.Write(ctx, key, count); err != nil {
+		s.log.Printf("error writing %s=%d: %v\n", key, count, err)
+	}
+}
+
+// gossipBody carries the sender's whole PN-counter.
+type gossipBody struct {
+	Type string `json:"type"`
+	PNCounter
+}
+
+// Gossip sends our PN-counter to every other node each interval. Merging is
+// idempotent, so it is sent without waiting for an acknowledgement and a
+// lost message is made up for by the next one.
+func (s *Server) Gossip() {
+	ticker := time.NewTicker(s.cfg.Interval)
+	go func() {
+		for range ticker.C {
+			s.gossip()
 		}
 	}()
 }
 
-func (s *Server) getCounter() int {
+func (s *Server) gossip() {
+	body := gossipBody{
+		Type:      "gossip",
+		PNCounter: s.counts(),
+	}
+
+	for _, node := range s.n.NodeIDs() {
+		if node == s.n.ID() {
+			continue
+		}
+
+		if err := s.n.Send(node, body); err != nil {
+			s.log.Printf("error gossiping to node: [%s]: %v\n", node, err)
+		}
+	}
+}
+
+func (s *Server) HandleGossip(msg maelstrom.Message) error {
+	var body gossipBody
+
+	if err := json.Unmarshal(msg.Body, &body); err != nil {
+		return err
+	}
+
+	if body.P == nil || body.N == nil {
+		return fmt.Errorf("gossip from %s is missing a p or n vector", msg.Src)
+	}
+	s.merge(body.PNCounter)
+
+	return nil
+}
+
+// counts returns a copy of the PN-counter.
+func (s *Server) counts() PNCounter {
 	s.muCache.Lock()
 	defer s.muCache.Unlock()
 
-	sum := 0
+	return s.localCache.Clone()
+}
 
-	for _, count := range s.localCache {
-		sum += count
-	}
+// merge takes the element-wise max of counts and the PN-counter.
+func (s *Server) merge(counts PNCounter) {
+	s.muCache.Lock()
+	defer s.muCache.Unlock()
+
+	s.localCache.Merge(counts)
+}
+
+func (s *Server) getCounter() int {
+	s.muCache.Lock()
+	defer s.muCache.Unlock()
 
-	return sum
+	return s.localCache.Value()
 }
@@ -0,0 +1,472 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"maelstrom-shared/countertest"
+	"maelstrom-shared/kv"
+	"strings"
+	"testing"
+	"time"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+var nodeIds = []string{"n0", "n1", "n2"}
+
+func newTestServer(t *testing.T, id string, store kv.KV) (*Server, *bytes.Buffer) {
+	return newTestServerWithConfig(t, id, store, DefaultConfig)
+}
+
+func newTestServerWithConfig(t *testing.T, id string, store kv.KV, cfg Config) (*Server, *bytes.Buffer) {
+	n, out := countertest.NewNode(id, nodeIds)
+
+	s, err := New(n, store, cfg)
+	if err != nil {
+		t.Fatalf("error creating server: %v", err)
+	}
+
+	init := map[string]any{"type": "init", "node_id": id, "node_ids": nodeIds}
+	if err := s.Init(countertest.Request(t, id, init)); err != nil {
+		t.Fatalf("error initialising server: %v", err)
+	}
+
+	return s, out
+}
+
+func readValue(t *testing.T, s *Server, out *bytes.Buffer) float64 {
+	if err := s.HandleRead(countertest.Request(t, s.n.ID(), map[string]any{"type": "read", "msg_id": 1})); err != nil {
+		t.Fatalf("error handling read: %v", err)
+	}
+
+	reply := countertest.LastReply(t, out)
+	if reply["type"] != "read_ok" {
+		t.Fatalf("expected read_ok, got %v", reply)
+	}
+	return reply["value"].(float64)
+}
+
+func TestHandleAddWritesOwnCount(t *testing.T) {
+	store := kv.NewLinKV()
+	s, out := newTestServer(t, "n0", store)
+
+	for i, delta := range []int{2, 3} {
+		add := map[string]any{"type": "add", "delta": delta, "msg_id": i + 1}
+		if err := s.HandleAdd(countertest.Request(t, "n0", add)); err != nil {
+			t.Fatalf("error handling add: %v", err)
+		}
+	}
+
+	val, err := store.ReadInt(context.Background(), pKey("n0"))
+	if err != nil {
+		t.Fatalf("error reading n0's count: %v", err)
+	}
+	if val != 5 {
+		t.Fatalf("expected n0's count to be %d, got %d", 5, val)
+	}
+
+	if val := readValue(t, s, out); val != 5 {
+		t.Fatalf("expected to read %d, got %v", 5, val)
+	}
+}
+
+func TestRefreshPicksUpOtherNodes(t *testing.T) {
+	store := kv.NewLinKV()
+	s0, out0 := newTestServer(t, "n0", store)
+	s1, _ := newTestServer(t, "n1", store)
+	s2, _ := newTestServer(t, "n2", store)
+
+	adds := []struct {
+		s     *Server
+		delta int
+	}{
+		{s: s0, delta: 1},
+		{s: s1, delta: 10},
+		{s: s2, delta: 100},
+	}
+	for _, add := range adds {
+		body := map[string]any{"type": "add", "delta": add.delta, "msg_id": 1}
+		if err := add.s.HandleAdd(countertest.Request(t, add.s.n.ID(), body)); err != nil {
+			t.Fatalf("error handling add: %v", err)
+		}
+	}
+
+	if val := readValue(t, s0, out0); val != 1 {
+		t.Fatalf("expected only n0's own adds before a refresh, got %v", val)
+	}
+
+	s0.refresh(context.Background())
+
+	if val := readValue(t, s0, out0); val != 111 {
+		t.Fatalf("expected every node's adds after a refresh, got %v", val)
+	}
+}
+
+// deliverGossip hands every gossip message in out to the server it was sent
+// to, dropping any sent to a node missing from servers.
+func deliverGossip(t *testing.T, out *bytes.Buffer, servers map[string]*Server) {
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var msg maelstrom.Message
+		if err := json.Unmarshal([]byte(line), &msg); err != nil {
+			t.Fatalf("error unmarshalling message: %v", err)
+		}
+		s, ok := servers[msg.Dest]
+		if msg.Type() != "gossip" || !ok {
+			continue
+		}
+
+		if err := s.HandleGossip(msg); err != nil {
+			t.Fatalf("error handling gossip: %v", err)
+		}
+	}
+	out.Reset()
+}
+
+func TestGossipWithoutKV(t *testing.T) {
+	cfg := Config{Sync: SyncGossip, Interval: time.Hour}
+
+	servers := make(map[string]*Server)
+	outs := make(map[string]*bytes.Buffer)
+	for i, id := range nodeIds {
+		s, out := newTestServerWithConfig(t, id, nil, cfg)
+		servers[id], outs[id] = s, out
+
+		body := map[string]any{"type": "add", "delta": i + 1, "msg_id": 1}
+		if err := s.HandleAdd(countertest.Request(t, id, body)); err != nil {
+			t.Fatalf("error handling add: %v", err)
+		}
+		out.Reset()
+	}
+
+	for _, id := range nodeIds {
+		servers[id].gossip()
+		deliverGossip(t, outs[id], servers)
+	}
+
+	for _, id := range nodeIds {
+		if val := readValue(t, servers[id], outs[id]); val != 6 {
+			t.Fatalf("expected %s to read %d after gossiping, got %v", id, 6, val)
+		}
+	}
+}
+
+func TestMergeKeepsLargerCounts(t *testing.T) {
+	cfg := Config{Sync: SyncGossip, Interval: time.Hour}
+	s, out := newTestServerWithConfig(t, "n0", nil, cfg)
+
+	s.merge(PNCounter{P: map[string]int{"n1": 5, "n2": 3}, N: map[string]int{"n1": 1}})
+	// stale and repeated gossip must not lower or double count anything
+	s.merge(PNCounter{P: map[string]int{"n1": 2, "n2": 3}, N: map[string]int{"n1": 1}})
+
+	if val := readValue(t, s, out); val != 7 {
+		t.Fatalf("expected to read %d, got %v", 7, val)
+	}
+}
+
+func TestDurableGossipWritesKV(t *testing.T) {
+	store := kv.NewSeqKV(0)
+	cfg := Config{Sync: SyncGossip, Interval: time.Hour, Durable: true}
+	s, _ := newTestServerWithConfig(t, "n0", store, cfg)
+
+	if err := s.HandleAdd(countertest.Request(t, "n0", map[string]any{"type": "add", "delta": 4, "msg_id": 1})); err != nil {
+		t.Fatalf("error handling add: %v", err)
+	}
+
+	val, err := store.ReadInt(context.Background(), pKey("n0"))
+	if err != nil {
+		t.Fatalf("error reading n0's count: %v", err)
+	}
+	if val != 4 {
+		t.Fatalf("expected n0's count to be %d, got %d", 4, val)
+	}
+}
+
+func TestNewNeedsKVForKVSync(t *testing.T) {
+	n := maelstrom.NewNode()
+
+	if _, err := New(n, nil, DefaultConfig); err == nil {
+		t.Fatalf("expected an error syncing through kv without a kv store")
+	}
+	if _, err := New(n, nil, Config{Sync: SyncGossip, Interval: time.Second, Durable: true}); err == nil {
+		t.Fatalf("expected an error writing durably without a kv store")
+	}
+	if _, err := New(n, nil, Config{Sync: "carrier-pigeon", Interval: time.Second}); err == nil {
+		t.Fatalf("expected an error for an unknown sync mode")
+	}
+}
+
+func TestNegativeDeltas(t *testing.T) {
+	store := kv.NewLinKV()
+	s0, out0 := newTestServer(t, "n0", store)
+	s1, _ := newTestServer(t, "n1", store)
+
+	adds := []struct {
+		s     *Server
+		delta int
+	}{
+		{s: s0, delta: 5},
+		{s: s0, delta: -7},
+		{s: s1, delta: -2},
+		{s: s1, delta: 3},
+	}
+	for _, add := range adds {
+		body := map[string]any{"type": "add", "delta": add.delta, "msg_id": 1}
+		if err := add.s.HandleAdd(countertest.Request(t, add.s.n.ID(), body)); err != nil {
+			t.Fatalf("error handling add: %v", err)
+		}
+	}
+
+	if val := readValue(t, s0, out0); val != -2 {
+		t.Fatalf("expected to read %d before a refresh, got %v", -2, val)
+	}
+
+	s0.refresh(context.Background())
+
+	if val := readValue(t, s0, out0); val != -1 {
+		t.Fatalf("expected to read %d after a refresh, got %v", -1, val)
+	}
+}
+
+func sessionConfig(sync string) Config {
+	return Config{Sync: sync, Interval: time.Hour, Session: true, SessionTimeout: 100 * time.Millisecond}
+}
+
+func addWithVersion(t *testing.T, s *Server, out *bytes.Buffer, delta int) map[string]any {
+	body := map[string]any{"type": "add", "delta": delta, "msg_id": 1}
+	if err := s.HandleAdd(countertest.Request(t, s.n.ID(), body)); err != nil {
+		t.Fatalf("error handling add: %v", err)
+	}
+
+	reply := countertest.LastReply(t, out)
+	version, ok := reply["version"].(map[string]any)
+	if !ok {
+		t.Fatalf("expected add_ok to carry a version, got %v", reply)
+	}
+	return version
+}
+
+func readAt(s *Server, version map[string]any) error {
+	buf, err := json.Marshal(map[string]any{"type": "read", "msg_id": 2, "version": version})
+	if err != nil {
+		return err
+	}
+	return s.HandleRead(maelstrom.Message{Src: "c1", Dest: s.n.ID(), Body: buf})
+}
+
+func TestSessionReadForcesRefresh(t *testing.T) {
+	store := kv.NewLinKV()
+	s0, out0 := newTestServerWithConfig(t, "n0", store, sessionConfig(SyncKV))
+	s1, out1 := newTestServerWithConfig(t, "n1", store, sessionConfig(SyncKV))
+
+	// the client writes through n1 then reads from n0, which hasn't refreshed
+	version := addWithVersion(t, s1, out1, 3)
+
+	if err := readAt(s0, version); err != nil {
+		t.Fatalf("error handling read: %v", err)
+	}
+
+	reply := countertest.LastReply(t, out0)
+	if reply["value"] != float64(3) {
+		t.Fatalf("expected the read to include the client's own add, got %v", reply)
+	}
+	if _, ok := reply["version"].(map[string]any); !ok {
+		t.Fatalf("expected read_ok to carry a version, got %v", reply)
+	}
+}
+
+func TestSessionReadTimesOut(t *testing.T) {
+	store := kv.NewSeqKV(1)
+	s0, out0 := newTestServerWithConfig(t, "n0", store, sessionConfig(SyncKV))
+	s1, out1 := newTestServerWithConfig(t, "n1", store, sessionConfig(SyncKV))
+
+	version := addWithVersion(t, s1, out1, 3)
+
+	// with seq-kv lagging the barrier never shows up, so we can't catch up
+	err := readAt(s0, version)
+	if code := maelstrom.ErrorCode(err); code != maelstrom.TemporarilyUnavailable {
+		t.Fatalf("expected a temporarily unavailable error, got %v", err)
+	}
+
+	store.SetLag(0)
+
+	if err := readAt(s0, version); err != nil {
+		t.Fatalf("error handling read once seq-kv caught up: %v", err)
+	}
+	if val := countertest.LastReply(t, out0)["value"]; val != float64(3) {
+		t.Fatalf("expected to read %d once seq-kv caught up, got %v", 3, val)
+	}
+}
+
+func TestSessionReadWaitsForGossip(t *testing.T) {
+	cfg := sessionConfig(SyncGossip)
+	cfg.SessionTimeout = time.Second
+
+	s0, out0 := newTestServerWithConfig(t, "n0", nil, cfg)
+	s1, out1 := newTestServerWithConfig(t, "n1", nil, cfg)
+
+	version := addWithVersion(t, s1, out1, -4)
+	out1.Reset()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- readAt(s0, version)
+	}()
+
+	time.Sleep(3 * sessionPoll)
+	select {
+	case err := <-done:
+		t.Fatalf("expected the read to wait for gossip, got %v", err)
+	default:
+	}
+
+	s1.gossip()
+	deliverGossip(t, out1, map[string]*Server{"n0": s0, "n1": s1})
+
+	if err := <-done; err != nil {
+		t.Fatalf("error handling read: %v", err)
+	}
+	if val := countertest.LastReply(t, out0)["value"]; val != float64(-4) {
+		t.Fatalf("expected to read %d after gossip, got %v", -4, val)
+	}
+}
+
+func TestSessionReadRejectsStaleIncrements(t *testing.T) {
+	s0, _ := newTestServerWithConfig(t, "n0", nil, sessionConfig(SyncGossip))
+
+	// n0 has seen n1's decrements but not its increments, so P+N matches
+	// the client's version even though n0 would read 5 too low
+	s0.localCache = PNCounter{P: map[string]int{"n1": 0}, N: map[string]int{"n1": 5}}
+	version := map[string]any{"p": map[string]any{"n1": 5}, "n": map[string]any{}}
+
+	err := readAt(s0, version)
+	if code := maelstrom.ErrorCode(err); code != maelstrom.TemporarilyUnavailable {
+		t.Fatalf("expected a temporarily unavailable error, got %v", err)
+	}
+}
+
+func TestRefreshSurvivesPartition(t *testing.T) {
+	store := kv.NewSeqKV(0)
+	s0, out0 := newTestServer(t, "n0", store)
+	s1, _ := newTestServer(t, "n1", store)
+
+	last := 0
+	checkRead := func(stage string) float64 {
+		val := readValue(t, s0, out0)
+		if int(val) < last {
+			t.Fatalf("%s: expected reads never to drop, went from %d to %v", stage, last, val)
+		}
+		last = int(val)
+		return val
+	}
+
+	add := func(delta int) {
+		body := map[string]any{"type": "add", "delta": delta, "msg_id": 1}
+		if err := s1.HandleAdd(countertest.Request(t, "n1", body)); err != nil {
+			t.Fatalf("error handling add: %v", err)
+		}
+	}
+
+	add(5)
+	s0.refresh(context.Background())
+	if val := checkRead("before the partition"); val != 5 {
+		t.Fatalf("expected to read %d before the partition, got %v", 5, val)
+	}
+
+	// n1's next write is lost, and n0 only sees stale values or errors
+	unavailable := maelstrom.NewRPCError(maelstrom.Timeout, "partitioned")
+	store.FailNext(unavailable)
+	add(2)
+
+	store.SetLag(1)
+	for i := 0; i < 3; i++ {
+		s0.refresh(context.Background())
+		checkRead("reading stale values")
+	}
+
+	store.FailNext(unavailable, unavailable, unavailable, unavailable)
+	s0.refresh(context.Background())
+	checkRead("failing to read")
+
+	// once it heals n1 puts back the write it lost, and n0 picks it up
+	store.SetLag(0)
+	s1.refresh(context.Background())
+	s0.refresh(context.Background())
+	if val := checkRead("after the partition heals"); val != 7 {
+		t.Fatalf("expected to read %d after the partition heals, got %v", 7, val)
+	}
+}
+
+func TestInitRestoresOwnCounts(t *testing.T) {
+	store := kv.NewLinKV()
+	s, _ := newTestServer(t, "n0", store)
+
+	for i, delta := range []int{5, -2} {
+		add := map[string]any{"type": "add", "delta": delta, "msg_id": i + 1}
+		if err := s.HandleAdd(countertest.Request(t, "n0", add)); err != nil {
+			t.Fatalf("error handling add: %v", err)
+		}
+	}
+
+	// n0 restarts against the same kv store
+	restarted, out := newTestServer(t, "n0", store)
+
+	if val := readValue(t, restarted, out); val != 3 {
+		t.Fatalf("expected to carry on from %d after a restart, got %v", 3, val)
+	}
+}
+
+// stalledKV holds every write until release is closed or the write's
+// context is done.
+type stalledKV struct {
+	*kv.Memory
+	release chan struct{}
+}
+
+func (s *stalledKV) Write(ctx context.Context, key string, value any) error {
+	select {
+	case <-s.release:
+		return s.Memory.Write(ctx, key, value)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func TestReadDoesNotWaitForWrites(t *testing.T) {
+	store := &stalledKV{Memory: kv.NewLinKV(), release: make(chan struct{})}
+	s, _ := newTestServer(t, "n0", store)
+
+	added := make(chan error, 1)
+	go func() {
+		add := map[string]any{"type": "add", "delta": 4, "msg_id": 1}
+		added <- s.HandleAdd(countertest.Request(t, "n0", add))
+	}()
+
+	// the add is counted as soon as it is in the cache, while its write
+	// is still stuck
+	for s.getCounter() != 4 {
+		time.Sleep(time.Millisecond)
+	}
+
+	read := make(chan error, 1)
+	go func() {
+		read <- s.HandleRead(countertest.Request(t, "n0", map[string]any{"type": "read", "msg_id": 2}))
+	}()
+
+	select {
+	case err := <-read:
+		if err != nil {
+			t.Fatalf("error handling read: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected the read not to wait for the stalled write")
+	}
+
+	close(store.release)
+	if err := <-added; err != nil {
+		t.Fatalf("error handling add: %v", err)
+	}
+	if val, err := store.ReadInt(context.Background(), pKey("n0")); err != nil || val != 4 {
+		t.Fatalf("expected n0's count to be written as %d, got %d, %v", 4, val, err)
+	}
+}
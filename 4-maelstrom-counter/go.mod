@@ -2,4 +2,9 @@ module maelstrom-counter
 
 go 1.21.0
 
-require github.com/jepsen-io/maelstrom/demo/go v0.0.0-20231231190402-2674df7c1076
+require (
+	github.com/jepsen-io/maelstrom/demo/go v0.0.0-20231231190402-2674df7c1076
+	maelstrom-shared v0.0.0
+)
+
+replace maelstrom-shared => ../maelstrom-shared
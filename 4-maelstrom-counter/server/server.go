@@ -3,8 +3,10 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"log"
-	"os"
+	"maelstrom-shared/kv"
+	"maelstrom-shared/logger"
 	"sync"
 	"time"
 
@@ -12,28 +14,37 @@ import (
 )
 
 const (
-	KEY_ID  = "counter"
-	LOCK_ID = "lock"
+	KEY_ID = "counter"
 )
 
 type nbrIds map[int]struct{}
 
+const (
+	commitAttempts = 5
+	minBackoff     = 10 * time.Millisecond
+	maxBackoff     = 200 * time.Millisecond
+	// kvTimeout is how long one call to the kv store may take.
+	kvTimeout = time.Second
+)
+
 type Server struct {
 	n  *maelstrom.Node
-	kv *maelstrom.KV
+	kv kv.KV
 
 	log *log.Logger
 
 	localDelta int
-	muDelta    sync.RWMutex
+	// inFlight is the delta a CAS is moving into the counter. Until the CAS
+	// returns, the counter may or may not include it.
+	inFlight int
+	// commits counts the CASes that have gone through, so a read can tell
+	// whether one landed while it was reading the counter.
+	commits int
+	muDelta sync.RWMutex
 }
 
-func New(n *maelstrom.Node, kv *maelstrom.KV) (*Server, error) {
-	log := log.New(
-		os.Stderr,
-		"",
-		log.Ldate|log.Ltime|log.Lmicroseconds,
-	)
+func New(n *maelstrom.Node, kv kv.KV) (*Server, error) {
+	log := logger.New()
 
 	return &Server{
 		n:   n,
@@ -44,8 +55,9 @@ func New(n *maelstrom.Node, kv *maelstrom.KV) (*Server, error) {
 }
 
 func (s *Server) Init(msg maelstrom.Message) error {
-	ctx := context.TODO()
-	s.kv.CompareAndSwap(ctx, LOCK_ID, 0, 0, true)
+	ctx, cancel := context.WithTimeout(context.Background(), kvTimeout)
+	defer cancel()
+
 	return s.kv.CompareAndSwap(ctx, KEY_ID, 0, 0, true)
 }
 
@@ -54,38 +66,60 @@ type ReadMSg struct {
 }
 
 func (s *Server) HandleRead(msg maelstrom.Message) error {
-	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(context.Background(), kvTimeout)
+	defer cancel()
 
-	// check that the global lock is not engaged and retry until it's free
-	for {
-		lockVal, err := s.kv.ReadInt(ctx, LOCK_ID)
-		if err != nil {
-			s.log.Printf("error getting global lock: %+v", err)
-		}
-		if lockVal == 1 {
-			s.log.Printf("global lock engaged: %d", lockVal)
-		} else {
-			break
-		}
-	}
-
-	val, err := s.kv.ReadInt(ctx, KEY_ID)
+	val, err := s.read(ctx)
 
 	if err != nil {
 		return err
 	}
 
-	s.muDelta.RLock()
-	s.log.Printf("value in counter is %d, remaining local writes are: %d", val, s.localDelta)
+	s.log.Printf("value in counter is %d", val)
 	out := map[string]any{
 		"type":  "read_ok",
-		"value": val + s.localDelta,
+		"value": val,
 	}
-	s.muDelta.RUnlock()
 
 	return s.n.Reply(msg, out)
 }
 
+// read returns the counter plus the adds that haven't been committed yet.
+// While a CAS is in flight we can't tell whether the counter includes its
+// delta, so we read again, backing off, until a read starts and ends with
+// no CAS landing in between.
+func (s *Server) read(ctx context.Context) (int, error) {
+	backoff := minBackoff
+	for {
+		s.muDelta.RLock()
+		commits, inFlight := s.commits, s.inFlight
+		s.muDelta.RUnlock()
+
+		if inFlight == 0 {
+			val, err := s.kv.ReadInt(ctx, KEY_ID)
+			if err != nil {
+				return 0, err
+			}
+
+			s.muDelta.RLock()
+			settled := s.commits == commits && s.inFlight == 0
+			delta := s.localDelta
+			s.muDelta.RUnlock()
+
+			if settled {
+				return val + delta, nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return 0, maelstrom.NewRPCError(maelstrom.TemporarilyUnavailable, "counter is being committed")
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, maxBackoff)
+	}
+}
+
 type AddMsg struct {
 	Type  string
 	Delta int
@@ -115,40 +149,75 @@ func (s *Server) CommitAdds() {
 	ticker := time.NewTicker(25 * time.Millisecond)
 	go func() {
 		for range ticker.C {
-			if s.localDelta == 0 {
-				continue
+			if err := s.commit(context.Background()); err != nil {
+				s.log.Printf("error in CommitAdds: %v\n", err)
 			}
-			ctx := context.TODO()
+		}
+	}()
+}
 
-			// try to get the global lock
-			err := s.kv.CompareAndSwap(ctx, LOCK_ID, 0, 1, false)
-			if err != nil {
-				continue
-			}
+// commit adds the buffered delta to the counter, retrying with backoff when
+// another node updates it first or the kv store errors. Only the delta that
+// made it into the counter is taken off the buffer, so nothing is lost when
+// every attempt fails or more adds arrive while we're committing.
+func (s *Server) commit(ctx context.Context) error {
+	s.muDelta.RLock()
+	delta := s.localDelta
+	s.muDelta.RUnlock()
 
-			// we have obtained the global lock
-			s.log.Printf("retrieving current value of counter")
-			prev, err := s.kv.ReadInt(ctx, KEY_ID)
-			s.log.Printf("counter has value %d", prev)
-			if err != nil {
-				s.log.Printf("error reading KEY_ID in CommitAdds: %v\n", err)
-			}
-			s.muDelta.Lock()
-			s.log.Printf("next delta is %d, Updating counter from: %d to: %d", s.localDelta, prev, prev+s.localDelta)
-			err = s.kv.CompareAndSwap(ctx, KEY_ID, prev, prev+s.localDelta, false)
+	if delta == 0 {
+		return nil
+	}
 
-			if err != nil {
-				s.log.Printf("error updating KEY_ID in CommitAdds: %v\n", err)
-			}
-			s.localDelta = 0
-			s.log.Printf("localDelta is now %d", s.localDelta)
-			s.muDelta.Unlock()
+	var err error
+	backoff := minBackoff
+	for attempt := 0; attempt < commitAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff = min(2*backoff, maxBackoff)
+		}
 
-			err = s.kv.CompareAndSwap(ctx, LOCK_ID, 1, 0, false)
-			s.log.Printf("released global lock")
-			if err != nil {
-				s.log.Println("someone else unlocked it :(")
-			}
+		var prev int
+		readCtx, cancel := context.WithTimeout(ctx, kvTimeout)
+		prev, err = s.kv.ReadInt(readCtx, KEY_ID)
+		cancel()
+		if err != nil {
+			continue
 		}
-	}()
+
+		if err = s.swap(ctx, prev, delta); err != nil {
+			continue
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("committing delta %d after %d attempts: %w", delta, commitAttempts, err)
+}
+
+// swap moves delta from localDelta into the counter, which is expected to
+// hold prev. The delta is held in inFlight while the CAS is out, and goes
+// back onto localDelta if it fails.
+func (s *Server) swap(ctx context.Context, prev int, delta int) error {
+	s.muDelta.Lock()
+	s.localDelta -= delta
+	s.inFlight = delta
+	s.muDelta.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, kvTimeout)
+	defer cancel()
+
+	err := s.kv.CompareAndSwap(ctx, KEY_ID, prev, prev+delta, false)
+
+	s.muDelta.Lock()
+	defer s.muDelta.Unlock()
+
+	s.inFlight = 0
+	if err != nil {
+		s.localDelta += delta
+		return err
+	}
+	s.commits++
+
+	return nil
 }
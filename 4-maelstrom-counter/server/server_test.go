@@ -0,0 +1,267 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"maelstrom-shared/countertest"
+	"maelstrom-shared/kv"
+	"testing"
+	"time"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+// hookedKV runs beforeCAS ahead of the next compare-and-swap and afterCAS
+// once it has gone through.
+type hookedKV struct {
+	*kv.Memory
+	beforeCAS func()
+	afterCAS  func()
+}
+
+func (h *hookedKV) CompareAndSwap(ctx context.Context, key string, from, to any, createIfNotExists bool) error {
+	if h.beforeCAS != nil {
+		h.beforeCAS()
+		h.beforeCAS = nil
+	}
+	err := h.Memory.CompareAndSwap(ctx, key, from, to, createIfNotExists)
+	if h.afterCAS != nil {
+		h.afterCAS()
+		h.afterCAS = nil
+	}
+	return err
+}
+
+func newTestServer(t *testing.T, store kv.KV) (*Server, *bytes.Buffer) {
+	n, out := countertest.NewNode("n0", []string{"n0"})
+
+	s, err := New(n, store)
+	if err != nil {
+		t.Fatalf("error creating server: %v", err)
+	}
+	if err := s.Init(countertest.Request(t, "n0", map[string]any{"type": "init"})); err != nil {
+		t.Fatalf("error initialising server: %v", err)
+	}
+
+	return s, out
+}
+
+func counterValue(t *testing.T, store kv.KV) int {
+	val, err := store.ReadInt(context.Background(), KEY_ID)
+	if err != nil {
+		t.Fatalf("error reading counter: %v", err)
+	}
+	return val
+}
+
+func TestCommitRetriesFailedCAS(t *testing.T) {
+	store := kv.NewLinKV()
+	s, _ := newTestServer(t, store)
+	s.localDelta = 5
+
+	// each attempt is a read followed by a cas, fail the first two cas
+	injected := errors.New("injected failure")
+	store.FailNext(nil, injected, nil, injected)
+
+	if err := s.commit(context.Background()); err != nil {
+		t.Fatalf("expected commit to succeed after retrying, got %v", err)
+	}
+
+	if val := counterValue(t, store); val != 5 {
+		t.Fatalf("expected counter to be %d, got %d", 5, val)
+	}
+	if s.localDelta != 0 {
+		t.Fatalf("expected committed delta to be cleared, got %d", s.localDelta)
+	}
+}
+
+func TestCommitKeepsDeltaWhenCASKeepsFailing(t *testing.T) {
+	store := kv.NewLinKV()
+	s, _ := newTestServer(t, store)
+	s.localDelta = 5
+
+	injected := errors.New("injected failure")
+	for i := 0; i < commitAttempts; i++ {
+		store.FailNext(nil, injected)
+	}
+
+	if err := s.commit(context.Background()); err == nil {
+		t.Fatalf("expected commit to fail once every attempt has failed")
+	}
+
+	if val := counterValue(t, store); val != 0 {
+		t.Fatalf("expected counter to be untouched, got %d", val)
+	}
+	if s.localDelta != 5 {
+		t.Fatalf("expected delta to be kept for the next commit, got %d", s.localDelta)
+	}
+
+	if err := s.commit(context.Background()); err != nil {
+		t.Fatalf("expected commit to succeed once the kv recovers, got %v", err)
+	}
+	if val := counterValue(t, store); val != 5 {
+		t.Fatalf("expected counter to be %d, got %d", 5, val)
+	}
+}
+
+func TestCommitKeepsAddsThatArriveMidCommit(t *testing.T) {
+	store := &hookedKV{Memory: kv.NewLinKV()}
+	s, _ := newTestServer(t, store)
+	s.localDelta = 5
+
+	// an add lands after the delta has been read but before it is committed
+	store.beforeCAS = func() {
+		s.muDelta.Lock()
+		s.localDelta += 3
+		s.muDelta.Unlock()
+	}
+
+	if err := s.commit(context.Background()); err != nil {
+		t.Fatalf("error committing: %v", err)
+	}
+
+	if val := counterValue(t, store); val != 5 {
+		t.Fatalf("expected counter to be %d, got %d", 5, val)
+	}
+	if s.localDelta != 3 {
+		t.Fatalf("expected the late add to be kept, got delta %d", s.localDelta)
+	}
+}
+
+func TestCommitRetriesAfterStaleRead(t *testing.T) {
+	store := kv.NewSeqKV(1)
+	s, _ := newTestServer(t, store)
+
+	// another node has already moved the counter on, but our reads lag
+	// behind that write
+	if err := store.Write(context.Background(), KEY_ID, 10); err != nil {
+		t.Fatalf("error writing counter: %v", err)
+	}
+	s.localDelta = 5
+
+	val, err := store.ReadInt(context.Background(), KEY_ID)
+	if err != nil || val != 0 {
+		t.Fatalf("expected a stale read of 0, got %d, %v", val, err)
+	}
+
+	if err := s.commit(context.Background()); err == nil {
+		t.Fatalf("expected every cas against the stale value to fail")
+	}
+
+	// once reads catch up the next commit goes through
+	store.SetLag(0)
+	if err := s.commit(context.Background()); err != nil {
+		t.Fatalf("error committing: %v", err)
+	}
+	if val := counterValue(t, store); val != 15 {
+		t.Fatalf("expected counter to be %d, got %d", 15, val)
+	}
+}
+
+func TestHandleReadIncludesUncommittedAdds(t *testing.T) {
+	store := kv.NewLinKV()
+	s, out := newTestServer(t, store)
+
+	if err := s.HandleAdd(countertest.Request(t, "n0", map[string]any{"type": "add", "delta": 4, "msg_id": 1})); err != nil {
+		t.Fatalf("error handling add: %v", err)
+	}
+	if reply := countertest.LastReply(t, out); reply["type"] != "add_ok" {
+		t.Fatalf("expected add_ok, got %v", reply)
+	}
+
+	if err := s.HandleRead(countertest.Request(t, "n0", map[string]any{"type": "read", "msg_id": 2})); err != nil {
+		t.Fatalf("error handling read: %v", err)
+	}
+	if reply := countertest.LastReply(t, out); reply["value"] != 4.0 {
+		t.Fatalf("expected read to include the uncommitted add, got %v", reply)
+	}
+
+	if err := s.commit(context.Background()); err != nil {
+		t.Fatalf("error committing: %v", err)
+	}
+
+	if err := s.HandleRead(countertest.Request(t, "n0", map[string]any{"type": "read", "msg_id": 3})); err != nil {
+		t.Fatalf("error handling read: %v", err)
+	}
+	if reply := countertest.LastReply(t, out); reply["value"] != 4.0 {
+		t.Fatalf("expected committing not to change the value read, got %v", reply)
+	}
+}
+
+func TestHandleReadDuringCommitCountsDeltaOnce(t *testing.T) {
+	store := &hookedKV{Memory: kv.NewLinKV()}
+	s, out := newTestServer(t, store)
+	s.localDelta = 5
+
+	// a read arrives once the cas is visible in the kv but before commit
+	// knows it went through
+	read := make(chan error, 1)
+	store.afterCAS = func() {
+		go func() {
+			read <- s.HandleRead(countertest.Request(t, "n0", map[string]any{"type": "read", "msg_id": 1}))
+		}()
+		select {
+		case err := <-read:
+			t.Errorf("expected the read to wait for the commit")
+			read <- err
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	if err := s.commit(context.Background()); err != nil {
+		t.Fatalf("error committing: %v", err)
+	}
+
+	if err := <-read; err != nil {
+		t.Fatalf("error handling read: %v", err)
+	}
+	if reply := countertest.LastReply(t, out); reply["value"] != 5.0 {
+		t.Fatalf("expected the read to count the delta once, got %v", reply)
+	}
+}
+
+func TestHandleReadDuringStalledCommit(t *testing.T) {
+	store := &hookedKV{Memory: kv.NewLinKV()}
+	s, out := newTestServer(t, store)
+	s.localDelta = 5
+
+	// the cas hangs, so while it is out no read can tell whether the
+	// counter includes the delta
+	release := make(chan struct{})
+	store.beforeCAS = func() {
+		<-release
+	}
+
+	committed := make(chan error, 1)
+	go func() {
+		committed <- s.commit(context.Background())
+	}()
+
+	for {
+		s.muDelta.RLock()
+		inFlight := s.inFlight
+		s.muDelta.RUnlock()
+		if inFlight != 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	err := s.HandleRead(countertest.Request(t, "n0", map[string]any{"type": "read", "msg_id": 1}))
+	if code := maelstrom.ErrorCode(err); code != maelstrom.TemporarilyUnavailable {
+		t.Fatalf("expected the read to give up with a temporarily unavailable error, got %v", err)
+	}
+
+	close(release)
+	if err := <-committed; err != nil {
+		t.Fatalf("error committing: %v", err)
+	}
+
+	if err := s.HandleRead(countertest.Request(t, "n0", map[string]any{"type": "read", "msg_id": 2})); err != nil {
+		t.Fatalf("error handling read: %v", err)
+	}
+	if reply := countertest.LastReply(t, out); reply["value"] != 5.0 {
+		t.Fatalf("expected to read %d once the commit settles, got %v", 5, reply)
+	}
+}
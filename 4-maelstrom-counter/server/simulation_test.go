@@ -0,0 +1,88 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"maelstrom-shared/simulator"
+	"sync"
+	"testing"
+	"time"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+func TestSimulatedCounterConverges(t *testing.T) {
+	nodeIds := []string{"n0", "n1", "n2"}
+	net := simulator.New(nodeIds, simulator.Config{
+		Latency: time.Millisecond,
+		Jitter:  2 * time.Millisecond,
+		Seed:    1,
+	})
+
+	for _, id := range nodeIds {
+		n := net.Node(id)
+
+		s, err := New(n, maelstrom.NewSeqKV(n))
+		if err != nil {
+			t.Fatalf("error creating server: %v", err)
+		}
+
+		n.Handle("init", s.Init)
+		n.Handle("read", s.HandleRead)
+		n.Handle("add", s.HandleAdd)
+
+		s.CommitAdds()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := net.Start(ctx); err != nil {
+		t.Fatalf("error starting network: %v", err)
+	}
+	defer net.Stop()
+
+	// some commits fail on the way, and have to be retried
+	unavailable := maelstrom.NewRPCError(maelstrom.TemporarilyUnavailable, "injected")
+	net.KV(maelstrom.SeqKV).FailNext(unavailable, unavailable, unavailable)
+
+	var wg sync.WaitGroup
+	for i, id := range nodeIds {
+		wg.Add(1)
+		go func(i int, id string) {
+			defer wg.Done()
+			for j := 1; j <= 10; j++ {
+				if _, err := net.RPC(ctx, id, map[string]any{"type": "add", "delta": j}); err != nil {
+					t.Errorf("error adding to %s: %v", id, err)
+				}
+			}
+		}(i, id)
+	}
+	wg.Wait()
+
+	expected := len(nodeIds) * 55
+	for _, id := range nodeIds {
+		for {
+			res, err := net.RPC(ctx, id, map[string]any{"type": "read"})
+			if err != nil {
+				t.Fatalf("error reading from %s: %v", id, err)
+			}
+
+			var body struct {
+				Value int
+			}
+			if err := json.Unmarshal(res.Body, &body); err != nil {
+				t.Fatalf("error unmarshalling read_ok: %v", err)
+			}
+			if body.Value == expected {
+				break
+			}
+
+			select {
+			case <-ctx.Done():
+				t.Fatalf("expected %s to read %d, got %d", id, expected, body.Value)
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}
+}
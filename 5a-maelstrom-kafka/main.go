@@ -9,17 +9,21 @@ import (
 
 func main() {
 	n := maelstrom.NewNode()
+	kv := maelstrom.NewLinKV(n)
 
-	s, err := server.New(n)
+	s, err := server.New(n, kv)
 
 	if err != nil {
 		panic(err)
 	}
 
+	n.Handle("init", s.Init)
 	n.Handle("send", s.HandleSend)
 	n.Handle("poll", s.HandlePoll)
 	n.Handle("commit_offsets", s.HandleCommitOffsets)
 	n.Handle("list_committed_offsets", s.HandleListCommittedOffsets)
+	n.Handle("replicate", s.HandleReplicate)
+	n.Handle("replicate_ok", s.HandleReplicateOk)
 
 	if err := n.Run(); err != nil {
 		log.Fatal(err)
@@ -6,8 +6,6 @@ import (
 
 type Kafka struct {
 	Logs map[string]*Topic
-	// Map consumers to a map of topics to offsets
-	Consumers map[string]map[string]int
 
 	logMu  sync.Mutex
 	offset int
@@ -15,15 +13,16 @@ type Kafka struct {
 
 func NewKafka() *Kafka {
 	logs := make(map[string]*Topic)
-	consumers := make(map[string]map[string]int)
 	return &Kafka{
-		Logs:      logs,
-		Consumers: consumers,
-		offset:    0,
+		Logs:   logs,
+		offset: 0,
 	}
 }
 
-func (k *Kafka) Append(key string, val int) int {
+func (k *Kafka) topic(key string) *Topic {
+	k.logMu.Lock()
+	defer k.logMu.Unlock()
+
 	topic, ok := k.Logs[key]
 
 	if !ok {
@@ -31,15 +30,49 @@ func (k *Kafka) Append(key string, val int) int {
 		k.Logs[key] = topic
 	}
 
-	offset := topic.Add(val)
+	return topic
+}
+
+func (k *Kafka) Append(key string, val int) int {
+	offset := k.topic(key).Add(val)
 
 	return offset
 }
 
+// Insert stores a value at an offset that was assigned by the key's owner.
+func (k *Kafka) Insert(key string, offset int, val int) {
+	k.topic(key).Set(offset, val)
+}
+
+// Keys returns every key with a log.
+func (k *Kafka) Keys() []string {
+	k.logMu.Lock()
+	defer k.logMu.Unlock()
+
+	keys := make([]string, 0, len(k.Logs))
+	for key := range k.Logs {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+// Since returns up to limit entries of key's log from offset on.
+func (k *Kafka) Since(key string, offset int, limit int) [][2]int {
+	return k.topic(key).Since(offset, limit)
+}
+
+// Len returns how many entries key's log has without a gap.
+func (k *Kafka) Len(key string) int {
+	return k.topic(key).Len()
+}
+
 func (k *Kafka) Poll(offsets map[string]int) map[string][][2]int {
 	msgs := make(map[string][][2]int)
 	for key, offset := range offsets {
+		k.logMu.Lock()
 		topic, ok := k.Logs[key]
+		k.logMu.Unlock()
 
 		if !ok {
 			continue
@@ -52,57 +85,68 @@ func (k *Kafka) Poll(offsets map[string]int) map[string][][2]int {
 	return msgs
 }
 
-func (k *Kafka) CommitOffsets(src string, offsets map[string]int) {
-	consumer, ok := k.Consumers[src]
+const maxPollSize = 10
 
-	if !ok {
-		consumer = make(map[string]int)
-	}
+type Topic struct {
+	Logs []int
+	mu   sync.Mutex
 
-	for key, val := range offsets {
-		consumer[key] = val
-	}
+	// entries received ahead of the end of Logs, keyed by offset
+	pending map[int]int
+}
+
+func (t *Topic) Add(val int) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 
-	k.Consumers[src] = consumer
+	t.Logs = append(t.Logs, val)
 
-	return
+	return len(t.Logs) - 1
 }
 
-func (k *Kafka) ListOffsets(src string, keys []string) map[string]int {
-	consumer, ok := k.Consumers[src]
-	if !ok {
-		consumer = make(map[string]int)
-	}
+// Set stores val at offset. Offsets past the end of the log are held back
+// until the gap before them has been filled, so Poll never skips an offset.
+func (t *Topic) Set(offset int, val int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 
-	offsets := make(map[string]int)
+	if offset < len(t.Logs) {
+		return
+	}
 
-	for _, key := range keys {
-		val, ok := consumer[key]
-		if !ok {
-			val = 0
+	if offset > len(t.Logs) {
+		if t.pending == nil {
+			t.pending = make(map[int]int)
 		}
-
-		offsets[key] = val
+		t.pending[offset] = val
+		return
 	}
 
-	return offsets
-}
+	t.Logs = append(t.Logs, val)
 
-type Topic struct {
-	Logs []int
-	mu   sync.Mutex
+	for {
+		next, ok := t.pending[len(t.Logs)]
+		if !ok {
+			break
+		}
+		delete(t.pending, len(t.Logs))
+		t.Logs = append(t.Logs, next)
+	}
 }
 
-func (t *Topic) Add(val int) int {
+func (t *Topic) Len() int {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
-	t.Logs = append(t.Logs, val)
-
-	return len(t.Logs) - 1
+	return len(t.Logs)
 }
 
 func (t *Topic) Poll(offset int) [][2]int {
+	return t.Since(offset, maxPollSize)
+}
+
+// Since returns up to limit entries from offset on, as offset, value pairs.
+func (t *Topic) Since(offset int, limit int) [][2]int {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
@@ -111,7 +155,7 @@ func (t *Topic) Poll(offset int) [][2]int {
 		return [][2]int{}
 	}
 
-	msgCount := min(10, maxOffset-offset)
+	msgCount := min(limit, maxOffset-offset)
 	msgs := make([][2]int, msgCount)
 
 	for i := 0; i < len(msgs); i++ {
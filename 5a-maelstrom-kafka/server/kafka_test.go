@@ -1,6 +1,9 @@
 package server
 
-import "testing"
+import (
+	"sync"
+	"testing"
+)
 
 func TestKafka(t *testing.T) {
 	kafka := NewKafka()
@@ -95,3 +98,71 @@ func TestTopicPoll(t *testing.T) {
 		}
 	}
 }
+
+func TestTopicSet(t *testing.T) {
+	topic := Topic{Logs: []int{}}
+
+	topic.Set(0, 10)
+	topic.Set(2, 12)
+	topic.Set(3, 13)
+
+	if len(topic.Logs) != 1 {
+		t.Fatalf("expected offsets after a gap to be held back, got logs %v", topic.Logs)
+	}
+
+	topic.Set(1, 11)
+	topic.Set(0, 99)
+
+	expected := []int{10, 11, 12, 13}
+	if len(topic.Logs) != len(expected) {
+		t.Fatalf("expected %d logs, got %d", len(expected), len(topic.Logs))
+	}
+	for i, val := range expected {
+		if topic.Logs[i] != val {
+			t.Fatalf("log is different at index %d, expected %d, got %d", i, val, topic.Logs[i])
+		}
+	}
+}
+
+// TestKafkaAppendLeavesNoHoles checks that an offset is only handed out along
+// with its message, so every acknowledged offset can be polled and polls
+// never stop short at a hole.
+func TestKafkaAppendLeavesNoHoles(t *testing.T) {
+	kafka := NewKafka()
+
+	var wg sync.WaitGroup
+	acked := make([][]int, 8)
+	for i := range acked {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				acked[i] = append(acked[i], kafka.Append("key", i*1000+j))
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	polled := make(map[int]int)
+	for offset := 0; ; {
+		msgs := kafka.Poll(map[string]int{"key": offset})["key"]
+		if len(msgs) == 0 {
+			break
+		}
+		for _, msg := range msgs {
+			if msg[0] != offset {
+				t.Fatalf("expected offset %d next, got %d", offset, msg[0])
+			}
+			polled[msg[0]] = msg[1]
+			offset++
+		}
+	}
+
+	for i, offsets := range acked {
+		for j, offset := range offsets {
+			if val, ok := polled[offset]; !ok || val != i*1000+j {
+				t.Fatalf("expected acknowledged offset %d to poll as %d, got %d (present %v)", offset, i*1000+j, val, ok)
+			}
+		}
+	}
+}
@@ -1,45 +1,66 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"hash/fnv"
 	"log"
-	"os"
+	"maelstrom-shared/logger"
+	"sync"
+	"time"
 
 	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
 )
 
 const (
-	KEY_ID  = "counter"
-	LOCK_ID = "lock"
+	// forwardTimeout is how long a send waits for the key's owner.
+	forwardTimeout = time.Second
+	// replicateInterval is how often entries a node hasn't acknowledged are
+	// sent to it again.
+	replicateInterval = 100 * time.Millisecond
+	// maxReplicateBatch caps the entries of one key sent in one message.
+	maxReplicateBatch = 100
 )
 
-type nbrIds map[int]struct{}
-
 type Server struct {
-	n *maelstrom.Node
+	n  *maelstrom.Node
+	kv *maelstrom.KV
+	// k holds every entry this node has appended as a key's owner or
+	// received from the owner through replication.
 	k *Kafka
 
+	ackedMu sync.Mutex
+	// acked maps each node to how much of each of our keys' logs they have
+	// without a gap.
+	acked map[string]map[string]int
+
 	log *log.Logger
 }
 
-func New(n *maelstrom.Node) (*Server, error) {
-	log := log.New(
-		os.Stderr,
-		"",
-		log.Ldate|log.Ltime|log.Lmicroseconds,
-	)
+func New(n *maelstrom.Node, kv *maelstrom.KV) (*Server, error) {
+	log := logger.New()
 
 	k := NewKafka()
 
 	return &Server{
-		n:   n,
-		log: log,
-		k:   k,
+		n:     n,
+		kv:    kv,
+		log:   log,
+		k:     k,
+		acked: make(map[string]map[string]int),
 	}, nil
 
 }
 
+// Init starts replication once the node knows its id and its peers.
+func (s *Server) Init(msg maelstrom.Message) error {
+	s.Replicate()
+
+	return nil
+}
+
 func (s *Server) Todo(msg maelstrom.Message) error {
 	return errors.New("todo")
 }
@@ -57,7 +78,13 @@ func (s *Server) HandleSend(msg maelstrom.Message) error {
 		return err
 	}
 
+	owner := s.owner(body.Key)
+	if owner != s.n.ID() {
+		return s.forwardSend(msg, owner, body)
+	}
+
 	offset := s.k.Append(body.Key, body.Msg)
+	s.replicate(body.Key, offset, body.Msg)
 
 	out := map[string]any{
 		"type":   "send_ok",
@@ -66,6 +93,165 @@ func (s *Server) HandleSend(msg maelstrom.Message) error {
 	return s.n.Reply(msg, out)
 }
 
+// forwardSend hands a send for a key owned by another node to that owner and
+// relays the offset it assigned back to the client.
+func (s *Server) forwardSend(msg maelstrom.Message, owner string, body SendBody) error {
+	ctx, cancel := context.WithTimeout(context.Background(), forwardTimeout)
+	defer cancel()
+
+	res, err := s.n.SyncRPC(ctx, owner, map[string]any{
+		"type": "send",
+		"key":  body.Key,
+		"msg":  body.Msg,
+	})
+	if err != nil {
+		// the owner may have appended it before going quiet, so this is
+		// indefinite
+		return maelstrom.NewRPCError(maelstrom.Crash, fmt.Sprintf("forward send to %s: %v", owner, err))
+	}
+
+	var resBody struct {
+		Offset int
+	}
+	if err := json.Unmarshal(res.Body, &resBody); err != nil {
+		return err
+	}
+
+	out := map[string]any{
+		"type":   "send_ok",
+		"offset": resBody.Offset,
+	}
+	return s.n.Reply(msg, out)
+}
+
+// ReplicateBody carries entries of keys the sender owns, as offset, value
+// pairs in offset order.
+type ReplicateBody struct {
+	Type    string              `json:"type"`
+	Entries map[string][][2]int `json:"entries"`
+}
+
+// ReplicateOkBody acknowledges replication with how much of each key's log
+// the sender has without a gap.
+type ReplicateOkBody struct {
+	Type    string         `json:"type"`
+	Offsets map[string]int `json:"offsets"`
+}
+
+// replicate pushes an entry appended by the owner to every other node so
+// that polls can be served anywhere. If it gets lost on the way the
+// background resend covers it, see Replicate.
+func (s *Server) replicate(key string, offset int, val int) {
+	for _, node := range s.n.NodeIDs() {
+		if node == s.n.ID() {
+			continue
+		}
+
+		s.sendEntries(node, map[string][][2]int{key: {{offset, val}}})
+	}
+}
+
+func (s *Server) sendEntries(node string, entries map[string][][2]int) {
+	err := s.n.Send(node, ReplicateBody{
+		Type:    "replicate",
+		Entries: entries,
+	})
+	if err != nil {
+		s.log.Printf("error replicating to %s: %v", node, err)
+	}
+}
+
+// Replicate starts resending, every interval, the entries of our keys that
+// each node hasn't acknowledged. A replica holds back entries after a gap,
+// so one lost message would otherwise stall its polls for good.
+//
+// Replication uses plain messages in both directions rather than RPCs, as
+// an RPC's callback is never cleaned up if the reply doesn't come.
+func (s *Server) Replicate() {
+	ticker := time.NewTicker(replicateInterval)
+	go func() {
+		for range ticker.C {
+			s.resend()
+		}
+	}()
+}
+
+func (s *Server) resend() {
+	owned := make([]string, 0)
+	for _, key := range s.k.Keys() {
+		if s.owner(key) == s.n.ID() {
+			owned = append(owned, key)
+		}
+	}
+
+	for _, node := range s.n.NodeIDs() {
+		if node == s.n.ID() {
+			continue
+		}
+
+		entries := make(map[string][][2]int)
+		for _, key := range owned {
+			if missing := s.k.Since(key, s.ackedLen(node, key), maxReplicateBatch); len(missing) > 0 {
+				entries[key] = missing
+			}
+		}
+
+		if len(entries) > 0 {
+			s.sendEntries(node, entries)
+		}
+	}
+}
+
+func (s *Server) ackedLen(node string, key string) int {
+	s.ackedMu.Lock()
+	defer s.ackedMu.Unlock()
+
+	return s.acked[node][key]
+}
+
+func (s *Server) HandleReplicate(msg maelstrom.Message) error {
+	var body ReplicateBody
+
+	if err := json.Unmarshal(msg.Body, &body); err != nil {
+		return err
+	}
+
+	offsets := make(map[string]int)
+	for key, entries := range body.Entries {
+		for _, entry := range entries {
+			s.k.Insert(key, entry[0], entry[1])
+		}
+		offsets[key] = s.k.Len(key)
+	}
+
+	return s.n.Send(msg.Src, ReplicateOkBody{
+		Type:    "replicate_ok",
+		Offsets: offsets,
+	})
+}
+
+func (s *Server) HandleReplicateOk(msg maelstrom.Message) error {
+	var body ReplicateOkBody
+
+	if err := json.Unmarshal(msg.Body, &body); err != nil {
+		return err
+	}
+
+	s.ackedMu.Lock()
+	defer s.ackedMu.Unlock()
+
+	acked, ok := s.acked[msg.Src]
+	if !ok {
+		acked = make(map[string]int)
+		s.acked[msg.Src] = acked
+	}
+	for key, offset := range body.Offsets {
+		acked[key] = max(acked[key], offset)
+	}
+
+	return nil
+}
+
 type PollBody struct {
 	Type    string
 	Offsets map[string]int
@@ -100,7 +286,13 @@ func (s *Server) HandleCommitOffsets(msg maelstrom.Message) error {
 		return err
 	}
 
-	s.k.CommitOffsets(msg.Src, body.Offsets)
+	ctx := context.Background()
+
+	for key, offset := range body.Offsets {
+		if err := s.commitOffset(ctx, msg.Src, key, offset); err != nil {
+			return err
+		}
+	}
 
 	out := map[string]any{
 		"type": "commit_offsets_ok",
@@ -121,7 +313,16 @@ func (s *Server) HandleListCommittedOffsets(msg maelstrom.Message) error {
 		return err
 	}
 
-	offsets := s.k.ListOffsets(msg.Src, body.Keys)
+	ctx := context.Background()
+
+	offsets := make(map[string]int)
+	for _, key := range body.Keys {
+		offset, err := s.kv.ReadInt(ctx, commitKey(msg.Src, key))
+		if err != nil && maelstrom.ErrorCode(err) != maelstrom.KeyDoesNotExist {
+			return err
+		}
+		offsets[key] = offset
+	}
 
 	out := map[string]any{
 		"type":    "list_committed_offsets_ok",
@@ -130,3 +331,39 @@ func (s *Server) HandleListCommittedOffsets(msg maelstrom.Message) error {
 
 	return s.n.Reply(msg, out)
 }
+
+func commitKey(src string, key string) string {
+	return fmt.Sprintf("commit_%s_%s", src, key)
+}
+
+// owner picks the node responsible for assigning offsets to key. NodeIDs is
+// in the same order on every node, so they all agree on the owner.
+func (s *Server) owner(key string) string {
+	nodes := s.n.NodeIDs()
+
+	h := fnv.New32a()
+	h.Write([]byte(key))
+
+	return nodes[h.Sum32()%uint32(len(nodes))]
+}
+
+// commitOffset records offset for src unless a later one is already stored.
+func (s *Server) commitOffset(ctx context.Context, src string, key string, offset int) error {
+	for {
+		prev, err := s.kv.ReadInt(ctx, commitKey(src, key))
+		if err != nil && maelstrom.ErrorCode(err) != maelstrom.KeyDoesNotExist {
+			return err
+		}
+		if err == nil && prev >= offset {
+			return nil
+		}
+
+		err = s.kv.CompareAndSwap(ctx, commitKey(src, key), prev, offset, true)
+		if err == nil {
+			return nil
+		}
+		if maelstrom.ErrorCode(err) != maelstrom.PreconditionFailed {
+			return err
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package server
+
+import (
+	"fmt"
+	"testing"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+func TestServerOwner(t *testing.T) {
+	nodeIds := []string{"n0", "n1", "n2"}
+
+	servers := make([]*Server, len(nodeIds))
+	for i, id := range nodeIds {
+		n := maelstrom.NewNode()
+		n.Init(id, nodeIds)
+
+		s, err := New(n, nil)
+		if err != nil {
+			t.Fatalf("error creating server: %v", err)
+		}
+		servers[i] = s
+	}
+
+	owners := make(map[string]int)
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("%d", i)
+
+		owner := servers[0].owner(key)
+		for _, s := range servers[1:] {
+			if s.owner(key) != owner {
+				t.Fatalf("nodes disagree on owner of key %s: %s and %s", key, owner, s.owner(key))
+			}
+		}
+		owners[owner] += 1
+	}
+
+	if len(owners) != len(nodeIds) {
+		t.Fatalf("expected keys to be spread over %d nodes, got %v", len(nodeIds), owners)
+	}
+}
@@ -0,0 +1,202 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maelstrom-shared/simulator"
+	"reflect"
+	"testing"
+	"time"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+// newSimulatedKafka starts a cluster of servers on a simulated network.
+func newSimulatedKafka(t *testing.T, ctx context.Context, nodeIds []string, cfg simulator.Config) (*simulator.Network, map[string]*Server) {
+	net := simulator.New(nodeIds, cfg)
+
+	servers := make(map[string]*Server)
+	for _, id := range nodeIds {
+		n := net.Node(id)
+
+		s, err := New(n, maelstrom.NewLinKV(n))
+		if err != nil {
+			t.Fatalf("error creating server: %v", err)
+		}
+		servers[id] = s
+
+		n.Handle("init", s.Init)
+		n.Handle("send", s.HandleSend)
+		n.Handle("poll", s.HandlePoll)
+		n.Handle("commit_offsets", s.HandleCommitOffsets)
+		n.Handle("list_committed_offsets", s.HandleListCommittedOffsets)
+		n.Handle("replicate", s.HandleReplicate)
+		n.Handle("replicate_ok", s.HandleReplicateOk)
+	}
+
+	if err := net.Start(ctx); err != nil {
+		t.Fatalf("error starting network: %v", err)
+	}
+	t.Cleanup(net.Stop)
+
+	return net, servers
+}
+
+// waitForPoll polls every node until each returns expected.
+func waitForPoll(t *testing.T, ctx context.Context, net *simulator.Network, nodeIds []string, expected map[string][][2]int) {
+	offsets := make(map[string]int)
+	for key := range expected {
+		offsets[key] = 0
+	}
+
+	for _, id := range nodeIds {
+		for {
+			res, err := net.RPC(ctx, id, map[string]any{"type": "poll", "offsets": offsets})
+			if err != nil {
+				t.Fatalf("error polling %s: %v", id, err)
+			}
+
+			var body struct {
+				Msgs map[string][][2]int
+			}
+			if err := json.Unmarshal(res.Body, &body); err != nil {
+				t.Fatalf("error unmarshalling poll_ok: %v", err)
+			}
+			if reflect.DeepEqual(body.Msgs, expected) {
+				break
+			}
+
+			select {
+			case <-ctx.Done():
+				t.Fatalf("expected %s to poll %v, got %v", id, expected, body.Msgs)
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}
+}
+
+func TestSimulatedKafka(t *testing.T) {
+	nodeIds := []string{"n0", "n1", "n2"}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	net, _ := newSimulatedKafka(t, ctx, nodeIds, simulator.Config{
+		Latency: time.Millisecond,
+		Jitter:  2 * time.Millisecond,
+		Seed:    1,
+	})
+
+	// sends go to every node, so most of them are forwarded to the owner
+	keys := []string{"k1", "k2", "k3"}
+	expected := make(map[string][][2]int)
+	for i := 0; i < 15; i++ {
+		key := keys[i%len(keys)]
+
+		res, err := net.RPC(ctx, nodeIds[i%2], map[string]any{"type": "send", "key": key, "msg": i})
+		if err != nil {
+			t.Fatalf("error sending %d to %s: %v", i, key, err)
+		}
+
+		var body struct {
+			Offset int
+		}
+		if err := json.Unmarshal(res.Body, &body); err != nil {
+			t.Fatalf("error unmarshalling send_ok: %v", err)
+		}
+
+		if prev := expected[key]; len(prev) > 0 && body.Offset <= prev[len(prev)-1][0] {
+			t.Fatalf("expected offsets in %s to increase, got %d after %d", key, body.Offset, prev[len(prev)-1][0])
+		}
+		expected[key] = append(expected[key], [2]int{body.Offset, i})
+	}
+
+	// every node ends up able to serve every key
+	waitForPoll(t, ctx, net, nodeIds, expected)
+
+	committed := map[string]int{"k1": expected["k1"][2][0], "k2": expected["k2"][4][0]}
+	if _, err := net.RPC(ctx, "n0", map[string]any{"type": "commit_offsets", "offsets": committed}); err != nil {
+		t.Fatalf("error committing offsets: %v", err)
+	}
+
+	res, err := net.RPC(ctx, "n2", map[string]any{"type": "list_committed_offsets", "keys": keys})
+	if err != nil {
+		t.Fatalf("error listing committed offsets: %v", err)
+	}
+
+	var body struct {
+		Offsets map[string]int
+	}
+	if err := json.Unmarshal(res.Body, &body); err != nil {
+		t.Fatalf("error unmarshalling list_committed_offsets_ok: %v", err)
+	}
+
+	committed["k3"] = 0
+	if !reflect.DeepEqual(body.Offsets, committed) {
+		t.Fatalf("expected another node to list %v, got %v", committed, body.Offsets)
+	}
+}
+
+func TestSimulatedKafkaReplicatesThroughDrops(t *testing.T) {
+	nodeIds := []string{"n0", "n1", "n2"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	net, servers := newSimulatedKafka(t, ctx, nodeIds, simulator.Config{
+		Latency:  time.Millisecond,
+		DropRate: 0.5,
+		Seed:     2,
+	})
+
+	// sends go straight to the owner, so only replication crosses the network
+	expected := make(map[string][][2]int)
+	for i := 0; i < 30; i++ {
+		key := fmt.Sprintf("k%d", i%5)
+		owner := servers["n0"].owner(key)
+
+		res, err := net.RPC(ctx, owner, map[string]any{"type": "send", "key": key, "msg": i})
+		if err != nil {
+			t.Fatalf("error sending %d to %s: %v", i, key, err)
+		}
+
+		var body struct {
+			Offset int
+		}
+		if err := json.Unmarshal(res.Body, &body); err != nil {
+			t.Fatalf("error unmarshalling send_ok: %v", err)
+		}
+		expected[key] = append(expected[key], [2]int{body.Offset, i})
+	}
+
+	waitForPoll(t, ctx, net, nodeIds, expected)
+
+	if stats := net.Stats(); stats.Dropped == 0 {
+		t.Fatalf("expected some replication to be dropped, got %+v", stats)
+	}
+}
+
+func TestSimulatedForwardTimesOut(t *testing.T) {
+	nodeIds := []string{"n0", "n1"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	net, servers := newSimulatedKafka(t, ctx, nodeIds, simulator.Config{})
+
+	key := "k0"
+	for i := 0; servers["n0"].owner(key) != "n1"; i++ {
+		key = fmt.Sprintf("k%d", i)
+	}
+
+	net.Partition([]string{"n0"})
+
+	start := time.Now()
+	_, err := net.RPC(ctx, "n0", map[string]any{"type": "send", "key": key, "msg": 1})
+	if maelstrom.ErrorCode(err) != maelstrom.Crash {
+		t.Fatalf("expected an indefinite error when the owner is unreachable, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*forwardTimeout {
+		t.Fatalf("expected the forward to give up after %v, took %v", forwardTimeout, elapsed)
+	}
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"maelstrom-shared/logger"
+	"maelstrom-shared/microop"
+	"maelstrom-shared/replog"
+	"sync"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+type Server struct {
+	n     *maelstrom.Node
+	store *Store
+
+	// applyMu makes applying a transaction and logging its writes one step,
+	// so the log holds transactions in the order they were applied here.
+	applyMu sync.Mutex
+	// txns holds the writes of every transaction committed here, in order,
+	// one slice of writes per transaction.
+	txns *replog.Log[[]microop.Op]
+
+	log *log.Logger
+}
+
+func New(n *maelstrom.Node) (*Server, error) {
+	log := logger.New()
+
+	s := &Server{
+		n:     n,
+		store: NewStore(),
+		log:   log,
+	}
+	s.txns = replog.New(n, s.applyReplicated)
+
+	return s, nil
+}
+
+type TxnBody struct {
+	Type string
+	Txn  []microop.Op
+}
+
+func (s *Server) HandleTxn(msg maelstrom.Message) error {
+	var body TxnBody
+
+	if err := json.Unmarshal(msg.Body, &body); err != nil {
+		return err
+	}
+
+	s.applyMu.Lock()
+	res, writes := s.store.Apply(body.Txn)
+	if len(writes) > 0 {
+		s.txns.Append(writes)
+	}
+	s.applyMu.Unlock()
+
+	out := map[string]any{
+		"type": "txn_ok",
+		"txn":  res,
+	}
+	return s.n.Reply(msg, out)
+}
+
+func (s *Server) HandleReplicate(msg maelstrom.Message) error {
+	return s.txns.HandleReplicate(msg)
+}
+
+func (s *Server) HandleReplicateOk(msg maelstrom.Message) error {
+	return s.txns.HandleReplicateOk(msg)
+}
+
+// applyReplicated applies the writes of transactions committed on another
+// node. Each transaction's writes are applied together, so nobody here sees
+// half of one.
+func (s *Server) applyReplicated(txns [][]microop.Op) {
+	for _, writes := range txns {
+		s.store.Apply(writes)
+	}
+}
+
+// Gossip starts sending committed writes to every other node in the
+// background, see replog.Log.
+func (s *Server) Gossip() {
+	s.txns.Gossip()
+}
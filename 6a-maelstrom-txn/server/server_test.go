@@ -0,0 +1,81 @@
+package server
+
+import (
+	"bytes"
+	"maelstrom-shared/microop"
+	"maelstrom-shared/txntest"
+	"testing"
+)
+
+var nodeIds = []string{"n0", "n1"}
+
+func newTestServer(t *testing.T, id string) (*Server, *bytes.Buffer) {
+	n, out := txntest.NewNode(id, nodeIds)
+
+	s, err := New(n)
+	if err != nil {
+		t.Fatalf("error creating server: %v", err)
+	}
+
+	return s, out
+}
+
+func txn(t *testing.T, s *Server, out *bytes.Buffer, ops string) []microop.Op {
+	return txntest.Txn(t, s.HandleTxn, out, s.n.ID(), ops)
+}
+
+func TestHandleTxn(t *testing.T) {
+	s, out := newTestServer(t, "n0")
+
+	res := txn(t, s, out, `[["w", 1, 4], ["r", 1, null], ["r", 2, null]]`)
+
+	if *res[1].Value != 4 {
+		t.Fatalf("expected to read back %d, got %d", 4, *res[1].Value)
+	}
+	if res[2].Value != nil {
+		t.Fatalf("expected an unwritten key to read as nil, got %d", *res[2].Value)
+	}
+}
+
+func TestGossipReplicatesWrites(t *testing.T) {
+	s0, out0 := newTestServer(t, "n0")
+	s1, out1 := newTestServer(t, "n1")
+
+	txn(t, s0, out0, `[["w", 1, 4], ["w", 2, 5]]`)
+	txn(t, s0, out0, `[["r", 1, null]]`)
+
+	if entries, _ := s0.txns.Unacked("n1"); len(entries) != 1 {
+		t.Fatalf("expected only the transaction that wrote to be replicated, got %+v", entries)
+	}
+
+	txntest.Exchange(t, s0.txns, s1.txns, out0, out1)
+
+	res := txn(t, s1, out1, `[["r", 1, null], ["r", 2, null]]`)
+	if res[0].Value == nil || *res[0].Value != 4 || res[1].Value == nil || *res[1].Value != 5 {
+		t.Fatalf("expected n1 to see n0's writes, got %+v", res)
+	}
+}
+
+func TestRedeliveredWritesDoNotRollBack(t *testing.T) {
+	s0, out0 := newTestServer(t, "n0")
+	s1, out1 := newTestServer(t, "n1")
+
+	txn(t, s0, out0, `[["w", 1, 4]]`)
+	s0.txns.GossipOnce()
+	stale := txntest.Sent(t, out0)
+
+	txn(t, s0, out0, `[["w", 1, 5]]`)
+	txntest.Exchange(t, s0.txns, s1.txns, out0, out1)
+
+	// the first batch turns up again after n1 has applied the second write
+	for _, msg := range stale {
+		if err := s1.HandleReplicate(msg); err != nil {
+			t.Fatalf("error handling replicate: %v", err)
+		}
+	}
+
+	res := txn(t, s1, out1, `[["r", 1, null]]`)
+	if res[0].Value == nil || *res[0].Value != 5 {
+		t.Fatalf("expected n1 to keep n0's latest write, got %+v", res)
+	}
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"maelstrom-shared/microop"
+	"sync"
+)
+
+// Store is an in-memory register per key.
+type Store struct {
+	mu   sync.RWMutex
+	regs map[int]int
+}
+
+func NewStore() *Store {
+	return &Store{regs: make(map[int]int)}
+}
+
+// Apply runs txn atomically: no other transaction's ops land between its
+// ops. It returns txn with every read's value filled in, along with the
+// writes it made so that they can be replicated.
+func (s *Store) Apply(txn []microop.Op) ([]microop.Op, []microop.Op) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := make([]microop.Op, len(txn))
+	writes := make([]microop.Op, 0)
+	for i, op := range txn {
+		switch op.Fn {
+		case microop.OP_READ:
+			op.Value = nil
+			if val, pres := s.regs[op.Key]; pres {
+				op.Value = &val
+			}
+		case microop.OP_WRITE:
+			s.regs[op.Key] = *op.Value
+			writes = append(writes, op)
+		}
+		res[i] = op
+	}
+
+	return res, writes
+}
+
+// Read returns the value of key, if it has one.
+func (s *Store) Read(key int) (int, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	val, pres := s.regs[key]
+	return val, pres
+}
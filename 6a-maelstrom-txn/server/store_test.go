@@ -0,0 +1,63 @@
+package server
+
+import (
+	"maelstrom-shared/microop"
+	"maelstrom-shared/txntest"
+	"sync"
+	"testing"
+)
+
+func TestStoreApply(t *testing.T) {
+	s := NewStore()
+
+	res, writes := s.Apply([]microop.Op{
+		{Fn: microop.OP_READ, Key: 1},
+		{Fn: microop.OP_WRITE, Key: 1, Value: txntest.IntPtr(3)},
+		{Fn: microop.OP_READ, Key: 1},
+	})
+
+	if res[0].Value != nil {
+		t.Fatalf("expected a read of an unwritten key to be nil, got %d", *res[0].Value)
+	}
+	if res[2].Value == nil || *res[2].Value != 3 {
+		t.Fatalf("expected a read to see the write before it, got %+v", res[2])
+	}
+	if len(writes) != 1 || writes[0].Key != 1 {
+		t.Fatalf("expected the one write to be returned, got %+v", writes)
+	}
+
+	if val, pres := s.Read(1); !pres || val != 3 {
+		t.Fatalf("expected key 1 to be %d, got %d (present %v)", 3, val, pres)
+	}
+}
+
+func TestStoreApplyAtomic(t *testing.T) {
+	s := NewStore()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 500; j++ {
+				val := i*1000 + j
+				s.Apply([]microop.Op{
+					{Fn: microop.OP_WRITE, Key: 1, Value: txntest.IntPtr(val)},
+					{Fn: microop.OP_WRITE, Key: 2, Value: txntest.IntPtr(val)},
+				})
+			}
+		}(i)
+	}
+
+	for i := 0; i < 500; i++ {
+		res, _ := s.Apply([]microop.Op{{Fn: microop.OP_READ, Key: 1}, {Fn: microop.OP_READ, Key: 2}})
+		if (res[0].Value == nil) != (res[1].Value == nil) {
+			t.Fatalf("expected both keys or neither to be written, got %+v", res)
+		}
+		if res[0].Value != nil && *res[0].Value != *res[1].Value {
+			t.Fatalf("expected to see a whole transaction, got %d and %d", *res[0].Value, *res[1].Value)
+		}
+	}
+
+	wg.Wait()
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"log"
+	"maelstrom-txn/server"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+func main() {
+	n := maelstrom.NewNode()
+
+	s, err := server.New(n)
+
+	if err != nil {
+		panic(err)
+	}
+
+	n.Handle("init", func(msg maelstrom.Message) error {
+		if err := s.Init(msg); err != nil {
+			return err
+		}
+
+		// gossip needs the node's id and its peers, which init sets
+		s.Gossip()
+		return nil
+	})
+	n.Handle("txn", s.HandleTxn)
+	n.Handle("replicate", s.HandleReplicate)
+	n.Handle("replicate_ok", s.HandleReplicateOk)
+
+	if err := n.Run(); err != nil {
+		log.Fatal(err)
+	}
+}
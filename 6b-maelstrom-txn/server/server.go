@@ -0,0 +1,122 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"maelstrom-shared/logger"
+	"maelstrom-shared/microop"
+	"maelstrom-shared/replog"
+	"maelstrom-shared/snowflake"
+	"sync"
+	"time"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+// versionedTxn is the writes of a committed transaction along with its
+// version, a snowflake ID that orders it against every other transaction.
+type versionedTxn struct {
+	Version uint64       `json:"version"`
+	Writes  []microop.Op `json:"writes"`
+}
+
+type Server struct {
+	n     *maelstrom.Node
+	store *Store
+
+	// worker hands out transaction versions. It observes every version we
+	// receive, so a transaction's version is always above those of the
+	// transactions it could have seen.
+	worker *snowflake.Worker
+	// applyMu makes taking a version and applying with it one step, so no
+	// transaction with a higher version lands in between.
+	applyMu sync.Mutex
+
+	// txns holds every transaction committed here, in order.
+	txns *replog.Log[versionedTxn]
+
+	log *log.Logger
+}
+
+func New(n *maelstrom.Node) (*Server, error) {
+	log := logger.New()
+
+	s := &Server{
+		n:     n,
+		store: NewStore(),
+		log:   log,
+	}
+	s.txns = replog.New(n, s.applyReplicated)
+
+	return s, nil
+}
+
+func (s *Server) Init(msg maelstrom.Message) error {
+	worker, err := snowflake.NewWorkerForNode(s.n.ID())
+	if err != nil {
+		return err
+	}
+	worker.SetSkewPolicy(snowflake.SkewBorrow, time.Second)
+	s.worker = worker
+
+	return nil
+}
+
+type TxnBody struct {
+	Type string
+	Txn  []microop.Op
+}
+
+func (s *Server) HandleTxn(msg maelstrom.Message) error {
+	var body TxnBody
+
+	if err := json.Unmarshal(msg.Body, &body); err != nil {
+		return err
+	}
+
+	s.applyMu.Lock()
+	version, err := s.worker.NextId()
+	if err != nil {
+		s.applyMu.Unlock()
+		return err
+	}
+	res, writes := s.store.Apply(body.Txn, version)
+	s.applyMu.Unlock()
+
+	if len(writes) > 0 {
+		s.txns.Append(versionedTxn{Version: version, Writes: writes})
+	}
+
+	out := map[string]any{
+		"type": "txn_ok",
+		"txn":  res,
+	}
+	return s.n.Reply(msg, out)
+}
+
+func (s *Server) HandleReplicate(msg maelstrom.Message) error {
+	return s.txns.HandleReplicate(msg)
+}
+
+func (s *Server) HandleReplicateOk(msg maelstrom.Message) error {
+	return s.txns.HandleReplicateOk(msg)
+}
+
+// applyReplicated applies transactions committed on another node. Each
+// transaction's writes are applied together, so nobody here sees half of
+// one, and under its own version, so stale ones lose.
+func (s *Server) applyReplicated(txns []versionedTxn) {
+	s.applyMu.Lock()
+	defer s.applyMu.Unlock()
+
+	for _, txn := range txns {
+		s.worker.Observe(txn.Version)
+		s.store.Apply(txn.Writes, txn.Version)
+	}
+}
+
+// Gossip starts sending committed transactions to every other node in the
+// background, see replog.Log.
+func (s *Server) Gossip() {
+	s.txns.Gossip()
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"maelstrom-shared/microop"
+	"sync"
+)
+
+// register is a key's value along with the version of the transaction that
+// wrote it.
+type register struct {
+	value   int
+	version uint64
+}
+
+// Store is an in-memory register per key where the last writer wins: a write
+// only lands if its transaction's version is at least as new as the
+// register's. Every replica applies the same rule, so whatever order
+// transactions arrive in they all end up with the same value for each key,
+// and every key's writes are ordered the same way, by version. That rules
+// out G0 cycles, where two transactions each overwrite the other's writes.
+//
+// Versions are unique per transaction, so two writes with the same version
+// can only come from one transaction and are applied in its order.
+type Store struct {
+	mu   sync.RWMutex
+	regs map[int]register
+}
+
+func NewStore() *Store {
+	return &Store{regs: make(map[int]register)}
+}
+
+// Apply runs txn atomically as the transaction with the given version: no
+// other transaction's ops land between its ops. It returns txn with every
+// read's value filled in, along with the writes it made so that they can be
+// replicated.
+func (s *Store) Apply(txn []microop.Op, version uint64) ([]microop.Op, []microop.Op) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := make([]microop.Op, len(txn))
+	writes := make([]microop.Op, 0)
+	for i, op := range txn {
+		switch op.Fn {
+		case microop.OP_READ:
+			op.Value = nil
+			if reg, pres := s.regs[op.Key]; pres {
+				op.Value = &reg.value
+			}
+		case microop.OP_WRITE:
+			if reg, pres := s.regs[op.Key]; !pres || version >= reg.version {
+				s.regs[op.Key] = register{value: *op.Value, version: version}
+			}
+			writes = append(writes, op)
+		}
+		res[i] = op
+	}
+
+	return res, writes
+}
+
+// Read returns the value of key and the version that wrote it, if it has
+// one.
+func (s *Store) Read(key int) (int, uint64, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	reg, pres := s.regs[key]
+	return reg.value, reg.version, pres
+}
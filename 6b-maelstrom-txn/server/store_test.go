@@ -0,0 +1,126 @@
+package server
+
+import (
+	"fmt"
+	"maelstrom-shared/microop"
+	"maelstrom-shared/txntest"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestStoreApply(t *testing.T) {
+	s := NewStore()
+
+	res, writes := s.Apply([]microop.Op{
+		{Fn: microop.OP_READ, Key: 1},
+		{Fn: microop.OP_WRITE, Key: 1, Value: txntest.IntPtr(3)},
+		{Fn: microop.OP_READ, Key: 1},
+	}, 1)
+
+	if res[0].Value != nil {
+		t.Fatalf("expected a read of an unwritten key to be nil, got %d", *res[0].Value)
+	}
+	if res[2].Value == nil || *res[2].Value != 3 {
+		t.Fatalf("expected a read to see the write before it, got %+v", res[2])
+	}
+	if len(writes) != 1 || writes[0].Key != 1 {
+		t.Fatalf("expected the one write to be returned, got %+v", writes)
+	}
+
+	if val, _, pres := s.Read(1); !pres || val != 3 {
+		t.Fatalf("expected key 1 to be %d, got %d (present %v)", 3, val, pres)
+	}
+}
+
+func TestStoreApplyAtomic(t *testing.T) {
+	s := NewStore()
+	var version atomic.Uint64
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 500; j++ {
+				val := i*1000 + j
+				s.Apply([]microop.Op{
+					{Fn: microop.OP_WRITE, Key: 1, Value: txntest.IntPtr(val)},
+					{Fn: microop.OP_WRITE, Key: 2, Value: txntest.IntPtr(val)},
+				}, version.Add(1))
+			}
+		}(i)
+	}
+
+	for i := 0; i < 500; i++ {
+		res, _ := s.Apply([]microop.Op{{Fn: microop.OP_READ, Key: 1}, {Fn: microop.OP_READ, Key: 2}}, 0)
+		if (res[0].Value == nil) != (res[1].Value == nil) {
+			t.Fatalf("expected both keys or neither to be written, got %+v", res)
+		}
+		if res[0].Value != nil && *res[0].Value != *res[1].Value {
+			t.Fatalf("expected to see a whole transaction, got %d and %d", *res[0].Value, *res[1].Value)
+		}
+	}
+
+	wg.Wait()
+}
+
+func TestStoreLastWriterWins(t *testing.T) {
+	s := NewStore()
+
+	s.Apply([]microop.Op{{Fn: microop.OP_WRITE, Key: 1, Value: txntest.IntPtr(10)}}, 10)
+	s.Apply([]microop.Op{{Fn: microop.OP_WRITE, Key: 1, Value: txntest.IntPtr(5)}}, 5)
+
+	if val, version, _ := s.Read(1); val != 10 || version != 10 {
+		t.Fatalf("expected a stale write to lose, got %d at version %d", val, version)
+	}
+
+	// a transaction's later write to a key beats its earlier one
+	res, _ := s.Apply([]microop.Op{
+		{Fn: microop.OP_WRITE, Key: 1, Value: txntest.IntPtr(20)},
+		{Fn: microop.OP_WRITE, Key: 1, Value: txntest.IntPtr(21)},
+		{Fn: microop.OP_READ, Key: 1},
+	}, 20)
+	if *res[2].Value != 21 {
+		t.Fatalf("expected to read the transaction's last write, got %d", *res[2].Value)
+	}
+}
+
+func TestStoreConvergesInAnyOrder(t *testing.T) {
+	for seed := int64(0); seed < 100; seed++ {
+		t.Run(fmt.Sprintf("seed=%d", seed), func(t *testing.T) {
+			r := rand.New(rand.NewSource(seed))
+
+			// transactions writing to overlapping keys, with unique versions
+			txns := make([]versionedTxn, 8)
+			for i, version := range r.Perm(len(txns)) {
+				writes := make([]microop.Op, 0)
+				for key := 0; key < 4; key++ {
+					if r.Intn(2) == 0 {
+						writes = append(writes, microop.Op{Fn: microop.OP_WRITE, Key: key, Value: txntest.IntPtr(i)})
+					}
+				}
+				txns[i] = versionedTxn{Version: uint64(version + 1), Writes: writes}
+			}
+
+			replicas := make([]*Store, 5)
+			for i := range replicas {
+				replicas[i] = NewStore()
+				for _, j := range r.Perm(len(txns)) {
+					replicas[i].Apply(txns[j].Writes, txns[j].Version)
+				}
+			}
+
+			for key := 0; key < 4; key++ {
+				val, version, pres := replicas[0].Read(key)
+				for i, replica := range replicas[1:] {
+					v, ver, p := replica.Read(key)
+					if v != val || ver != version || p != pres {
+						t.Fatalf("replicas 0 and %d disagree on key %d: %d@%d and %d@%d", i+1, key, val, version, v, ver)
+					}
+				}
+			}
+		})
+	}
+}
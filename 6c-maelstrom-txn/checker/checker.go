@@ -0,0 +1,104 @@
+// Package checker looks for read-committed anomalies in a recorded history
+// of transactions against a txn-rw-register service.
+package checker
+
+import (
+	"fmt"
+	"maelstrom-shared/microop"
+)
+
+// Entry is one transaction in a history: its micro-ops as the client saw
+// them, with reads filled in, and whether it committed. Only the writes of
+// an aborted entry matter, as values nobody should ever read.
+type Entry struct {
+	Ops       []microop.Op
+	Committed bool
+}
+
+const (
+	// G1a is a read of a value written by a transaction that aborted.
+	G1a = "G1a"
+	// G1b is a read of a value a transaction wrote and then overwrote
+	// itself, so it was never meant to be seen.
+	G1b = "G1b"
+)
+
+// Anomaly is a read that shouldn't have been possible. Reader and Writer are
+// indexes into the history.
+type Anomaly struct {
+	Kind   string
+	Reader int
+	Writer int
+	Key    int
+	Value  int
+}
+
+func (a Anomaly) String() string {
+	return fmt.Sprintf("%s: txn %d read %d from key %d, written by txn %d", a.Kind, a.Reader, a.Value, a.Key, a.Writer)
+}
+
+// write identifies a value written to a key. Like Maelstrom's workloads, the
+// checker relies on every value written to a key being unique.
+type write struct {
+	key   int
+	value int
+}
+
+// writer is the transaction that made a write and whether it was its final
+// write to that key.
+type writer struct {
+	txn   int
+	final bool
+}
+
+// Check returns every G1a and G1b read in history. Reads a transaction makes
+// of its own writes are allowed, whatever becomes of them.
+func Check(history []Entry) []Anomaly {
+	writers := make(map[write]writer)
+	for i, entry := range history {
+		last := make(map[int]int)
+		for _, op := range entry.Ops {
+			if op.Fn == microop.OP_WRITE {
+				last[op.Key] = *op.Value
+			}
+		}
+
+		for _, op := range entry.Ops {
+			if op.Fn == microop.OP_WRITE {
+				w := write{key: op.Key, value: *op.Value}
+				writers[w] = writer{txn: i, final: last[op.Key] == *op.Value}
+			}
+		}
+	}
+
+	anomalies := make([]Anomaly, 0)
+	for i, entry := range history {
+		if !entry.Committed {
+			continue
+		}
+
+		for _, op := range entry.Ops {
+			if op.Fn != microop.OP_READ || op.Value == nil {
+				continue
+			}
+
+			w, pres := writers[write{key: op.Key, value: *op.Value}]
+			if !pres || w.txn == i {
+				continue
+			}
+
+			anomaly := Anomaly{Reader: i, Writer: w.txn, Key: op.Key, Value: *op.Value}
+			switch {
+			case !history[w.txn].Committed:
+				anomaly.Kind = G1a
+			case !w.final:
+				anomaly.Kind = G1b
+			default:
+				continue
+			}
+			anomalies = append(anomalies, anomaly)
+		}
+	}
+
+	return anomalies
+}
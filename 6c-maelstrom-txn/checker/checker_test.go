@@ -0,0 +1,152 @@
+package checker
+
+import (
+	"fmt"
+	"maelstrom-shared/microop"
+	"maelstrom-shared/txntest"
+	"maelstrom-txn/server"
+	"math/rand"
+	"testing"
+)
+
+func r(key int, val *int) microop.Op {
+	return microop.Op{Fn: microop.OP_READ, Key: key, Value: val}
+}
+
+func w(key, val int) microop.Op {
+	return microop.Op{Fn: microop.OP_WRITE, Key: key, Value: &val}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		history  []Entry
+		expected []string
+	}{
+		{
+			name: "committed reads",
+			history: []Entry{
+				{Ops: []microop.Op{w(1, 1), w(1, 2)}, Committed: true},
+				{Ops: []microop.Op{r(1, txntest.IntPtr(2)), r(2, nil)}, Committed: true},
+			},
+			expected: []string{},
+		},
+		{
+			name: "aborted read",
+			history: []Entry{
+				{Ops: []microop.Op{w(1, 1)}, Committed: false},
+				{Ops: []microop.Op{r(1, txntest.IntPtr(1))}, Committed: true},
+			},
+			expected: []string{G1a},
+		},
+		{
+			name: "intermediate read",
+			history: []Entry{
+				{Ops: []microop.Op{w(1, 1), w(2, 5), w(1, 2)}, Committed: true},
+				{Ops: []microop.Op{r(1, txntest.IntPtr(1)), r(2, txntest.IntPtr(5))}, Committed: true},
+			},
+			expected: []string{G1b},
+		},
+		{
+			name: "own writes",
+			history: []Entry{
+				{Ops: []microop.Op{w(1, 1), r(1, txntest.IntPtr(1)), w(1, 2)}, Committed: true},
+				{Ops: []microop.Op{w(2, 1), r(2, txntest.IntPtr(1))}, Committed: false},
+			},
+			expected: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			anomalies := Check(tt.history)
+
+			if len(anomalies) != len(tt.expected) {
+				t.Fatalf("expected %v, got %v", tt.expected, anomalies)
+			}
+			for i, a := range anomalies {
+				if a.Kind != tt.expected[i] {
+					t.Fatalf("expected %v, got %v", tt.expected, anomalies)
+				}
+			}
+		})
+	}
+}
+
+// replica is a store along with the write sets it hasn't been sent yet.
+type replica struct {
+	store   *server.Store
+	pending []pendingCommit
+}
+
+type pendingCommit struct {
+	writes  []microop.Op
+	version uint64
+}
+
+// TestStoreHistory runs random transactions against replicated stores, some
+// of them aborting and some writing a key more than once, with write sets
+// reaching the other replicas late and out of order, and checks the history.
+func TestStoreHistory(t *testing.T) {
+	for seed := int64(0); seed < 20; seed++ {
+		t.Run(fmt.Sprintf("seed=%d", seed), func(t *testing.T) {
+			rnd := rand.New(rand.NewSource(seed))
+
+			replicas := make([]*replica, 3)
+			for i := range replicas {
+				replicas[i] = &replica{store: server.NewStore()}
+			}
+
+			history := make([]Entry, 0)
+			version := uint64(0)
+			next := 0
+			for i := 0; i < 300; i++ {
+				rep := replicas[rnd.Intn(len(replicas))]
+
+				// deliver some of what's been sent to this replica
+				rnd.Shuffle(len(rep.pending), func(a, b int) {
+					rep.pending[a], rep.pending[b] = rep.pending[b], rep.pending[a]
+				})
+				keep := rnd.Intn(len(rep.pending) + 1)
+				for _, c := range rep.pending[keep:] {
+					rep.store.Commit(c.writes, c.version)
+				}
+				rep.pending = rep.pending[:keep]
+
+				ops := make([]microop.Op, 0)
+				for j := rnd.Intn(4) + 1; j > 0; j-- {
+					key := rnd.Intn(3)
+					if rnd.Intn(2) == 0 {
+						ops = append(ops, r(key, nil))
+					} else {
+						next++
+						ops = append(ops, w(key, next))
+					}
+				}
+
+				txn := rep.store.Begin()
+				res := txn.Run(ops)
+
+				if rnd.Intn(5) == 0 {
+					txn.Abort()
+					history = append(history, Entry{Ops: res, Committed: false})
+					continue
+				}
+
+				version++
+				writes := txn.WriteSet()
+				txn.Commit(version)
+				for _, other := range replicas {
+					if other != rep {
+						other.pending = append(other.pending, pendingCommit{writes: writes, version: version})
+					}
+				}
+				history = append(history, Entry{Ops: res, Committed: true})
+			}
+
+			if anomalies := Check(history); len(anomalies) != 0 {
+				t.Fatalf("expected no anomalies, got %v", anomalies)
+			}
+		})
+	}
+}
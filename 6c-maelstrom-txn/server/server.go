@@ -0,0 +1,140 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"maelstrom-shared/logger"
+	"maelstrom-shared/microop"
+	"maelstrom-shared/replog"
+	"maelstrom-shared/snowflake"
+	"sync"
+	"time"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+// versionedTxn is the write set of a committed transaction along with its
+// version, a snowflake ID that orders it against every other transaction.
+type versionedTxn struct {
+	Version uint64       `json:"version"`
+	Writes  []microop.Op `json:"writes"`
+}
+
+type Server struct {
+	n     *maelstrom.Node
+	store *Store
+
+	// worker hands out transaction versions as they commit. It observes
+	// every version we receive before the writes become readable, so a
+	// transaction's version is above those of every transaction it read
+	// from as well as every one it overwrote. With every dependency going
+	// from a lower version to a higher one they can't form a cycle (G1c).
+	worker *snowflake.Worker
+	// applyMu makes taking a version and committing with it one step, so no
+	// transaction with a higher version lands in between.
+	applyMu sync.Mutex
+
+	// txns holds every transaction committed here, in order.
+	txns *replog.Log[versionedTxn]
+
+	log *log.Logger
+}
+
+func New(n *maelstrom.Node) (*Server, error) {
+	log := logger.New()
+
+	s := &Server{
+		n:     n,
+		store: NewStore(),
+		log:   log,
+	}
+	s.txns = replog.New(n, s.applyReplicated)
+
+	return s, nil
+}
+
+func (s *Server) Init(msg maelstrom.Message) error {
+	worker, err := snowflake.NewWorkerForNode(s.n.ID())
+	if err != nil {
+		return err
+	}
+	worker.SetSkewPolicy(snowflake.SkewBorrow, time.Second)
+	s.worker = worker
+
+	return nil
+}
+
+type TxnBody struct {
+	Type string
+	Txn  []microop.Op
+}
+
+func (s *Server) HandleTxn(msg maelstrom.Message) error {
+	var body TxnBody
+
+	if err := json.Unmarshal(msg.Body, &body); err != nil {
+		return err
+	}
+
+	txn := s.store.Begin()
+	res := txn.Run(body.Txn)
+
+	if writes := txn.WriteSet(); len(writes) > 0 {
+		if err := s.commit(txn, writes); err != nil {
+			return err
+		}
+	}
+
+	out := map[string]any{
+		"type": "txn_ok",
+		"txn":  res,
+	}
+	return s.n.Reply(msg, out)
+}
+
+// commit gives txn a version and makes its writes visible here, then queues
+// the whole write set to be replicated. If it can't get a version it aborts,
+// and none of its writes are seen anywhere.
+func (s *Server) commit(txn *Txn, writes []microop.Op) error {
+	s.applyMu.Lock()
+	version, err := s.worker.NextId()
+	if err != nil {
+		s.applyMu.Unlock()
+		txn.Abort()
+		return maelstrom.NewRPCError(maelstrom.TxnConflict, fmt.Sprintf("aborted: %v", err))
+	}
+	txn.Commit(version)
+	s.applyMu.Unlock()
+
+	s.txns.Append(versionedTxn{Version: version, Writes: writes})
+
+	return nil
+}
+
+func (s *Server) HandleReplicate(msg maelstrom.Message) error {
+	return s.txns.HandleReplicate(msg)
+}
+
+func (s *Server) HandleReplicateOk(msg maelstrom.Message) error {
+	return s.txns.HandleReplicateOk(msg)
+}
+
+// applyReplicated commits transactions committed on another node. Each
+// write set is committed whole, so nobody here sees half of a transaction,
+// and under its own version, so stale ones lose.
+func (s *Server) applyReplicated(txns []versionedTxn) {
+	s.applyMu.Lock()
+	defer s.applyMu.Unlock()
+
+	for _, txn := range txns {
+		s.worker.Observe(txn.Version)
+		s.store.Commit(txn.Writes, txn.Version)
+	}
+}
+
+// Gossip starts sending committed transactions to every other node in the
+// background, see replog.Log.
+func (s *Server) Gossip() {
+	s.txns.Gossip()
+}
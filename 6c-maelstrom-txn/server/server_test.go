@@ -0,0 +1,108 @@
+package server
+
+import (
+	"bytes"
+	"maelstrom-shared/microop"
+	"maelstrom-shared/txntest"
+	"testing"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+var nodeIds = []string{"n0", "n1"}
+
+func newTestServer(t *testing.T, id string) (*Server, *bytes.Buffer) {
+	n, out := txntest.NewNode(id, nodeIds)
+
+	s, err := New(n)
+	if err != nil {
+		t.Fatalf("error creating server: %v", err)
+	}
+	if err := s.Init(maelstrom.Message{}); err != nil {
+		t.Fatalf("error initialising server: %v", err)
+	}
+
+	return s, out
+}
+
+func txn(t *testing.T, s *Server, out *bytes.Buffer, ops string) []microop.Op {
+	return txntest.Txn(t, s.HandleTxn, out, s.n.ID(), ops)
+}
+
+func TestHandleTxn(t *testing.T) {
+	s, out := newTestServer(t, "n0")
+
+	res := txn(t, s, out, `[["w", 1, 4], ["r", 1, null], ["r", 2, null]]`)
+
+	if *res[1].Value != 4 {
+		t.Fatalf("expected to read back %d, got %d", 4, *res[1].Value)
+	}
+	if res[2].Value != nil {
+		t.Fatalf("expected an unwritten key to read as nil, got %d", *res[2].Value)
+	}
+}
+
+func TestGossipReplicatesWrites(t *testing.T) {
+	s0, out0 := newTestServer(t, "n0")
+	s1, out1 := newTestServer(t, "n1")
+
+	txn(t, s0, out0, `[["w", 1, 3], ["w", 1, 4], ["w", 2, 5]]`)
+	txn(t, s0, out0, `[["r", 1, null]]`)
+
+	if txns, _ := s0.txns.Unacked("n1"); len(txns) != 1 || len(txns[0].Writes) != 2 {
+		t.Fatalf("expected one write set with only the final writes, got %+v", txns)
+	}
+
+	txntest.Exchange(t, s0.txns, s1.txns, out0, out1)
+
+	res := txn(t, s1, out1, `[["r", 1, null], ["r", 2, null]]`)
+	if res[0].Value == nil || *res[0].Value != 4 || res[1].Value == nil || *res[1].Value != 5 {
+		t.Fatalf("expected n1 to see n0's writes, got %+v", res)
+	}
+}
+
+func TestConcurrentWritesConverge(t *testing.T) {
+	s0, out0 := newTestServer(t, "n0")
+	s1, out1 := newTestServer(t, "n1")
+
+	// while partitioned, both nodes overwrite the same keys
+	txn(t, s0, out0, `[["w", 1, 10], ["w", 2, 10]]`)
+	txn(t, s1, out1, `[["w", 2, 20], ["w", 1, 20]]`)
+
+	txntest.Exchange(t, s0.txns, s1.txns, out0, out1)
+
+	r0 := txn(t, s0, out0, `[["r", 1, null], ["r", 2, null]]`)
+	r1 := txn(t, s1, out1, `[["r", 1, null], ["r", 2, null]]`)
+
+	if *r0[0].Value != *r1[0].Value || *r0[1].Value != *r1[1].Value {
+		t.Fatalf("expected the nodes to converge, got %+v and %+v", r0, r1)
+	}
+	// a cycle would need each transaction to win one key
+	if *r0[0].Value != *r0[1].Value {
+		t.Fatalf("expected one transaction to win both keys, got %d and %d", *r0[0].Value, *r0[1].Value)
+	}
+}
+
+func TestLaterTransactionsWin(t *testing.T) {
+	s0, out0 := newTestServer(t, "n0")
+	s1, out1 := newTestServer(t, "n1")
+
+	// n1's write has a version ahead of anything n0 has generated
+	s1.worker.Observe(1 << 62)
+	txn(t, s1, out1, `[["w", 1, 1]]`)
+	txntest.Exchange(t, s0.txns, s1.txns, out0, out1)
+
+	// having seen it, n0's next write must be ordered after it
+	txn(t, s0, out0, `[["w", 1, 2]]`)
+	txntest.Exchange(t, s0.txns, s1.txns, out0, out1)
+
+	for _, pair := range []struct {
+		s   *Server
+		out *bytes.Buffer
+	}{{s0, out0}, {s1, out1}} {
+		res := txn(t, pair.s, pair.out, `[["r", 1, null]]`)
+		if *res[0].Value != 2 {
+			t.Fatalf("expected %s to read the later write %d, got %d", pair.s.n.ID(), 2, *res[0].Value)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"maelstrom-shared/microop"
+	"sync"
+)
+
+// register is a key's committed value along with the version of the
+// transaction that wrote it.
+type register struct {
+	value   int
+	version uint64
+}
+
+// Store holds the committed value of every key. It only ever sees whole
+// write sets of committed transactions, so it never has a value from a
+// transaction that is still running or was aborted, nor one a transaction
+// went on to overwrite.
+//
+// Write sets land by last writer wins: a write only lands if its
+// transaction's version is at least as new as the register's. Every replica
+// applies the same rule, so they all end up with the same value for each key
+// whatever order write sets arrive in.
+type Store struct {
+	mu   sync.RWMutex
+	regs map[int]register
+}
+
+func NewStore() *Store {
+	return &Store{regs: make(map[int]register)}
+}
+
+// Commit applies the write set of the transaction with the given version
+// atomically: a reader sees all of it or none of it.
+func (s *Store) Commit(writes []microop.Op, version uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, op := range writes {
+		if reg, pres := s.regs[op.Key]; !pres || version >= reg.version {
+			s.regs[op.Key] = register{value: *op.Value, version: version}
+		}
+	}
+}
+
+// Read returns the committed value of key and the version that wrote it, if
+// it has one.
+func (s *Store) Read(key int) (int, uint64, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	reg, pres := s.regs[key]
+	return reg.value, reg.version, pres
+}
+
+// Begin starts a transaction against the store.
+func (s *Store) Begin() *Txn {
+	return &Txn{
+		store:  s,
+		writes: make(map[int]int),
+	}
+}
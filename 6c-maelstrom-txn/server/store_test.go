@@ -0,0 +1,139 @@
+package server
+
+import (
+	"fmt"
+	"maelstrom-shared/microop"
+	"maelstrom-shared/txntest"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestTxnBuffersWrites(t *testing.T) {
+	s := NewStore()
+	txn := s.Begin()
+
+	res := txn.Run([]microop.Op{
+		{Fn: microop.OP_READ, Key: 1},
+		{Fn: microop.OP_WRITE, Key: 1, Value: txntest.IntPtr(3)},
+		{Fn: microop.OP_WRITE, Key: 1, Value: txntest.IntPtr(4)},
+		{Fn: microop.OP_READ, Key: 1},
+	})
+
+	if res[0].Value != nil {
+		t.Fatalf("expected a read of an unwritten key to be nil, got %d", *res[0].Value)
+	}
+	if res[3].Value == nil || *res[3].Value != 4 {
+		t.Fatalf("expected a read to see the transaction's own write, got %+v", res[3])
+	}
+	if _, _, pres := s.Read(1); pres {
+		t.Fatalf("expected nothing to be visible before commit")
+	}
+
+	writes := txn.WriteSet()
+	if len(writes) != 1 || *writes[0].Value != 4 {
+		t.Fatalf("expected only the final write in the write set, got %+v", writes)
+	}
+
+	txn.Commit(1)
+	if val, _, pres := s.Read(1); !pres || val != 4 {
+		t.Fatalf("expected key 1 to be %d after commit, got %d (present %v)", 4, val, pres)
+	}
+}
+
+func TestTxnAbort(t *testing.T) {
+	s := NewStore()
+	txn := s.Begin()
+
+	txn.Run([]microop.Op{{Fn: microop.OP_WRITE, Key: 1, Value: txntest.IntPtr(3)}})
+	txn.Abort()
+
+	if writes := txn.WriteSet(); len(writes) != 0 {
+		t.Fatalf("expected an aborted transaction to have no writes, got %+v", writes)
+	}
+	if _, _, pres := s.Read(1); pres {
+		t.Fatalf("expected an aborted write never to be visible")
+	}
+}
+
+func TestStoreCommitAtomic(t *testing.T) {
+	s := NewStore()
+	var version atomic.Uint64
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 500; j++ {
+				val := i*1000 + j
+				s.Commit([]microop.Op{
+					{Fn: microop.OP_WRITE, Key: 1, Value: txntest.IntPtr(val)},
+					{Fn: microop.OP_WRITE, Key: 2, Value: txntest.IntPtr(val)},
+				}, version.Add(1))
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	v1, ver1, _ := s.Read(1)
+	v2, ver2, _ := s.Read(2)
+	if v1 != v2 || ver1 != ver2 {
+		t.Fatalf("expected both keys to hold the newest write set, got %d@%d and %d@%d", v1, ver1, v2, ver2)
+	}
+}
+
+func TestStoreLastWriterWins(t *testing.T) {
+	s := NewStore()
+
+	s.Commit([]microop.Op{{Fn: microop.OP_WRITE, Key: 1, Value: txntest.IntPtr(10)}}, 10)
+	s.Commit([]microop.Op{{Fn: microop.OP_WRITE, Key: 1, Value: txntest.IntPtr(5)}}, 5)
+
+	if val, version, _ := s.Read(1); val != 10 || version != 10 {
+		t.Fatalf("expected a stale write to lose, got %d at version %d", val, version)
+	}
+
+	s.Commit([]microop.Op{{Fn: microop.OP_WRITE, Key: 1, Value: txntest.IntPtr(20)}}, 20)
+	if val, version, _ := s.Read(1); val != 20 || version != 20 {
+		t.Fatalf("expected a newer write to win, got %d at version %d", val, version)
+	}
+}
+
+func TestStoreConvergesInAnyOrder(t *testing.T) {
+	for seed := int64(0); seed < 100; seed++ {
+		t.Run(fmt.Sprintf("seed=%d", seed), func(t *testing.T) {
+			r := rand.New(rand.NewSource(seed))
+
+			// transactions writing to overlapping keys, with unique versions
+			txns := make([]versionedTxn, 8)
+			for i, version := range r.Perm(len(txns)) {
+				writes := make([]microop.Op, 0)
+				for key := 0; key < 4; key++ {
+					if r.Intn(2) == 0 {
+						writes = append(writes, microop.Op{Fn: microop.OP_WRITE, Key: key, Value: txntest.IntPtr(i)})
+					}
+				}
+				txns[i] = versionedTxn{Version: uint64(version + 1), Writes: writes}
+			}
+
+			replicas := make([]*Store, 5)
+			for i := range replicas {
+				replicas[i] = NewStore()
+				for _, j := range r.Perm(len(txns)) {
+					replicas[i].Commit(txns[j].Writes, txns[j].Version)
+				}
+			}
+
+			for key := 0; key < 4; key++ {
+				val, version, pres := replicas[0].Read(key)
+				for i, replica := range replicas[1:] {
+					v, ver, p := replica.Read(key)
+					if v != val || ver != version || p != pres {
+						t.Fatalf("replicas 0 and %d disagree on key %d: %d@%d and %d@%d", i+1, key, val, version, v, ver)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package server
+
+import "maelstrom-shared/microop"
+
+// Txn buffers a transaction's writes until it commits. Its reads see its own
+// writes first and otherwise the latest committed value, so nothing it
+// writes is visible to anybody else before Commit, and nothing at all if it
+// aborts.
+type Txn struct {
+	store *Store
+
+	// writes maps each key written to the last value written to it
+	writes map[int]int
+	// keys lists the keys written in the order they were first written
+	keys []int
+}
+
+// Run executes ops in order, returning them with every read's value filled
+// in.
+func (t *Txn) Run(ops []microop.Op) []microop.Op {
+	res := make([]microop.Op, len(ops))
+	for i, op := range ops {
+		switch op.Fn {
+		case microop.OP_READ:
+			op.Value = nil
+			if val, pres := t.writes[op.Key]; pres {
+				op.Value = &val
+			} else if val, _, pres := t.store.Read(op.Key); pres {
+				op.Value = &val
+			}
+		case microop.OP_WRITE:
+			if _, pres := t.writes[op.Key]; !pres {
+				t.keys = append(t.keys, op.Key)
+			}
+			t.writes[op.Key] = *op.Value
+		}
+		res[i] = op
+	}
+
+	return res
+}
+
+// WriteSet returns the final write to each key. Earlier writes to a key
+// were overwritten inside the transaction and are never replicated.
+func (t *Txn) WriteSet() []microop.Op {
+	writes := make([]microop.Op, len(t.keys))
+	for i, key := range t.keys {
+		val := t.writes[key]
+		writes[i] = microop.Op{Fn: microop.OP_WRITE, Key: key, Value: &val}
+	}
+
+	return writes
+}
+
+// Commit makes the write set visible with the given version.
+func (t *Txn) Commit(version uint64) {
+	t.store.Commit(t.WriteSet(), version)
+}
+
+// Abort throws the buffered writes away.
+func (t *Txn) Abort() {
+	t.writes = make(map[int]int)
+	t.keys = nil
+}
@@ -0,0 +1,49 @@
+// Package countertest holds the helpers the counter servers' tests share for
+// driving a server through its handlers and reading back its replies.
+package countertest
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+// NewNode returns a node initialised as id in a cluster of nodeIds, writing
+// what it sends to the returned buffer.
+func NewNode(id string, nodeIds []string) (*maelstrom.Node, *bytes.Buffer) {
+	var out bytes.Buffer
+
+	n := maelstrom.NewNode()
+	n.Init(id, nodeIds)
+	n.Stdout = &out
+
+	return n, &out
+}
+
+// Request returns a client's message to dest carrying body.
+func Request(t *testing.T, dest string, body map[string]any) maelstrom.Message {
+	buf, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("error marshalling request: %v", err)
+	}
+	return maelstrom.Message{Src: "c1", Dest: dest, Body: buf}
+}
+
+// LastReply returns the body of the last message written to out.
+func LastReply(t *testing.T, out *bytes.Buffer) map[string]any {
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+
+	var msg maelstrom.Message
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &msg); err != nil {
+		t.Fatalf("error unmarshalling reply: %v", err)
+	}
+
+	var body map[string]any
+	if err := json.Unmarshal(msg.Body, &body); err != nil {
+		t.Fatalf("error unmarshalling reply body: %v", err)
+	}
+	return body
+}
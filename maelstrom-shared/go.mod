@@ -0,0 +1,5 @@
+module maelstrom-shared
+
+go 1.21.0
+
+require github.com/jepsen-io/maelstrom/demo/go v0.0.0-20231231190402-2674df7c1076
@@ -0,0 +1,183 @@
+package kv
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+// KV is the part of *maelstrom.KV that servers use, so that they can run
+// against Memory in tests.
+type KV interface {
+	Read(ctx context.Context, key string) (any, error)
+	ReadInt(ctx context.Context, key string) (int, error)
+	Write(ctx context.Context, key string, value any) error
+	CompareAndSwap(ctx context.Context, key string, from, to any, createIfNotExists bool) error
+}
+
+var _ KV = (*maelstrom.KV)(nil)
+
+// Memory is an in-memory stand-in for Maelstrom's kv services. Values go
+// through JSON on the way in and out, as they would over the wire.
+//
+// By default it behaves like lin-kv and every read sees the latest write.
+// With a lag it behaves like seq-kv, where reads may trail behind writes;
+// compare-and-swaps always check against the latest value.
+type Memory struct {
+	mu sync.Mutex
+
+	// versions holds every value written to a key, oldest first
+	versions map[string][]json.RawMessage
+	lag      int
+	// failures are returned by the next calls, one per call
+	failures []error
+}
+
+// NewLinKV returns an empty store where every read sees the latest write.
+func NewLinKV() *Memory {
+	return &Memory{versions: make(map[string][]json.RawMessage)}
+}
+
+// NewSeqKV returns an empty store where reads see the value lag writes
+// behind the latest.
+func NewSeqKV(lag int) *Memory {
+	m := NewLinKV()
+	m.lag = lag
+	return m
+}
+
+// SetLag changes how many writes behind the latest reads are.
+func (m *Memory) SetLag(lag int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lag = lag
+}
+
+// FailNext makes the next calls return errs, one each, in order.
+func (m *Memory) FailNext(errs ...error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.failures = append(m.failures, errs...)
+}
+
+func (m *Memory) injectedFailure() error {
+	if len(m.failures) == 0 {
+		return nil
+	}
+
+	err := m.failures[0]
+	m.failures = m.failures[1:]
+	return err
+}
+
+func (m *Memory) Read(ctx context.Context, key string) (any, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.injectedFailure(); err != nil {
+		return nil, err
+	}
+
+	versions := m.versions[key]
+	i := len(versions) - 1 - m.lag
+	if len(versions) == 0 || i < 0 {
+		return nil, maelstrom.NewRPCError(maelstrom.KeyDoesNotExist, "key does not exist")
+	}
+
+	return decode(versions[i])
+}
+
+// ReadInt reads key as an int, failing if it holds anything else rather
+// than reading it as 0.
+func (m *Memory) ReadInt(ctx context.Context, key string) (int, error) {
+	v, err := m.Read(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+
+	i, ok := v.(int)
+	if !ok {
+		return 0, fmt.Errorf("value of key %q is %T, not an int", key, v)
+	}
+	return i, nil
+}
+
+func (m *Memory) Write(ctx context.Context, key string, value any) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.injectedFailure(); err != nil {
+		return err
+	}
+
+	return m.write(key, value)
+}
+
+func (m *Memory) CompareAndSwap(ctx context.Context, key string, from, to any, createIfNotExists bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.injectedFailure(); err != nil {
+		return err
+	}
+
+	versions := m.versions[key]
+	if len(versions) == 0 {
+		if !createIfNotExists {
+			return maelstrom.NewRPCError(maelstrom.KeyDoesNotExist, "key does not exist")
+		}
+		return m.write(key, to)
+	}
+
+	current, err := decode(versions[len(versions)-1])
+	if err != nil {
+		return err
+	}
+	expected, err := roundTrip(from)
+	if err != nil {
+		return err
+	}
+	if !reflect.DeepEqual(current, expected) {
+		return maelstrom.NewRPCError(maelstrom.PreconditionFailed, "current value does not match from")
+	}
+
+	return m.write(key, to)
+}
+
+func (m *Memory) write(key string, value any) error {
+	buf, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	m.versions[key] = append(m.versions[key], buf)
+	return nil
+}
+
+// decode turns stored JSON back into a value the way *maelstrom.KV does,
+// with top level numbers as ints.
+func decode(buf json.RawMessage) (any, error) {
+	var v any
+	if err := json.Unmarshal(buf, &v); err != nil {
+		return nil, err
+	}
+
+	if f, ok := v.(float64); ok {
+		return int(f), nil
+	}
+	return v, nil
+}
+
+func roundTrip(value any) (any, error) {
+	buf, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return decode(buf)
+}
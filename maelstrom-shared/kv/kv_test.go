@@ -0,0 +1,109 @@
+package kv
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+func TestMemoryLinKV(t *testing.T) {
+	ctx := context.Background()
+	m := NewLinKV()
+
+	if _, err := m.ReadInt(ctx, "a"); maelstrom.ErrorCode(err) != maelstrom.KeyDoesNotExist {
+		t.Fatalf("expected KeyDoesNotExist for a missing key, got %v", err)
+	}
+
+	if err := m.CompareAndSwap(ctx, "a", 0, 1, false); maelstrom.ErrorCode(err) != maelstrom.KeyDoesNotExist {
+		t.Fatalf("expected KeyDoesNotExist for a cas on a missing key, got %v", err)
+	}
+	if err := m.CompareAndSwap(ctx, "a", 0, 1, true); err != nil {
+		t.Fatalf("error creating key with cas: %v", err)
+	}
+	if err := m.CompareAndSwap(ctx, "a", 0, 2, false); maelstrom.ErrorCode(err) != maelstrom.PreconditionFailed {
+		t.Fatalf("expected PreconditionFailed for a stale cas, got %v", err)
+	}
+	if err := m.CompareAndSwap(ctx, "a", 1, 2, false); err != nil {
+		t.Fatalf("error swapping value: %v", err)
+	}
+
+	val, err := m.ReadInt(ctx, "a")
+	if err != nil {
+		t.Fatalf("error reading key: %v", err)
+	}
+	if val != 2 {
+		t.Fatalf("expected %d, got %d", 2, val)
+	}
+}
+
+func TestMemoryValuesGoThroughJSON(t *testing.T) {
+	ctx := context.Background()
+	m := NewLinKV()
+
+	if err := m.Write(ctx, "m", map[string]int{"n0": 1}); err != nil {
+		t.Fatalf("error writing map: %v", err)
+	}
+
+	val, err := m.Read(ctx, "m")
+	if err != nil {
+		t.Fatalf("error reading map: %v", err)
+	}
+	if val.(map[string]any)["n0"] != 1.0 {
+		t.Fatalf("expected nested numbers to come back as float64, got %#v", val)
+	}
+
+	if err := m.CompareAndSwap(ctx, "m", map[string]int{"n0": 1}, map[string]int{"n0": 2}, false); err != nil {
+		t.Fatalf("expected cas to match equal values of different types, got %v", err)
+	}
+
+	if _, err := m.ReadInt(ctx, "m"); err == nil {
+		t.Fatalf("expected an error reading a map as an int")
+	}
+}
+
+func TestMemorySeqKVLags(t *testing.T) {
+	ctx := context.Background()
+	m := NewSeqKV(1)
+
+	for i := 1; i <= 3; i++ {
+		if err := m.Write(ctx, "a", i); err != nil {
+			t.Fatalf("error writing: %v", err)
+		}
+	}
+
+	val, _ := m.ReadInt(ctx, "a")
+	if val != 2 {
+		t.Fatalf("expected a read one write behind, got %d", val)
+	}
+
+	// compare-and-swap still checks the latest value
+	if err := m.CompareAndSwap(ctx, "a", 3, 4, false); err != nil {
+		t.Fatalf("expected cas against the latest value to succeed, got %v", err)
+	}
+
+	m.SetLag(0)
+	val, _ = m.ReadInt(ctx, "a")
+	if val != 4 {
+		t.Fatalf("expected the latest value once caught up, got %d", val)
+	}
+}
+
+func TestMemoryFailNext(t *testing.T) {
+	ctx := context.Background()
+	m := NewLinKV()
+	injected := errors.New("injected")
+
+	m.FailNext(injected, maelstrom.NewRPCError(maelstrom.Timeout, "timed out"))
+
+	if err := m.Write(ctx, "a", 1); !errors.Is(err, injected) {
+		t.Fatalf("expected the first injected error, got %v", err)
+	}
+	if _, err := m.Read(ctx, "a"); maelstrom.ErrorCode(err) != maelstrom.Timeout {
+		t.Fatalf("expected the second injected error, got %v", err)
+	}
+	if err := m.Write(ctx, "a", 1); err != nil {
+		t.Fatalf("expected calls to succeed once failures are used up, got %v", err)
+	}
+}
@@ -0,0 +1,16 @@
+package logger
+
+import (
+	"log"
+	"os"
+)
+
+// New returns the logger every Server writes its diagnostics with. Maelstrom
+// reads messages from stdout, so logs go to stderr.
+func New() *log.Logger {
+	return log.New(
+		os.Stderr,
+		"",
+		log.Ldate|log.Ltime|log.Lmicroseconds,
+	)
+}
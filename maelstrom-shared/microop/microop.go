@@ -0,0 +1,53 @@
+package microop
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	OP_READ  = "r"
+	OP_WRITE = "w"
+)
+
+// Op is one micro-op in a transaction, sent over the wire as [fn, key, value]:
+// ["r", 1, null] reads key 1 and ["w", 1, 5] writes 5 to it. A read's value
+// is nil until it has been applied, and stays nil if the key was never
+// written.
+type Op struct {
+	Fn    string
+	Key   int
+	Value *int
+}
+
+func (o Op) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]any{o.Fn, o.Key, o.Value})
+}
+
+func (o *Op) UnmarshalJSON(buf []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(buf, &raw); err != nil {
+		return err
+	}
+	if len(raw) != 3 {
+		return fmt.Errorf("expected micro-op [fn, key, value], got %s", buf)
+	}
+
+	if err := json.Unmarshal(raw[0], &o.Fn); err != nil {
+		return fmt.Errorf("unmarshal micro-op fn: %w", err)
+	}
+	if o.Fn != OP_READ && o.Fn != OP_WRITE {
+		return fmt.Errorf("unknown micro-op %q", o.Fn)
+	}
+	if err := json.Unmarshal(raw[1], &o.Key); err != nil {
+		return fmt.Errorf("unmarshal micro-op key: %w", err)
+	}
+	if err := json.Unmarshal(raw[2], &o.Value); err != nil {
+		return fmt.Errorf("unmarshal micro-op value: %w", err)
+	}
+	if o.Fn == OP_WRITE && o.Value == nil {
+		return fmt.Errorf("write to key %d is missing a value", o.Key)
+	}
+
+	return nil
+}
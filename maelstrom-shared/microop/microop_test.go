@@ -0,0 +1,37 @@
+package microop
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestOpJSON(t *testing.T) {
+	var txn []Op
+	if err := json.Unmarshal([]byte(`[["r", 1, null], ["w", 2, 7]]`), &txn); err != nil {
+		t.Fatalf("error unmarshalling txn: %v", err)
+	}
+
+	if txn[0].Fn != OP_READ || txn[0].Key != 1 || txn[0].Value != nil {
+		t.Fatalf("expected a read of key 1, got %+v", txn[0])
+	}
+	if txn[1].Fn != OP_WRITE || txn[1].Key != 2 || *txn[1].Value != 7 {
+		t.Fatalf("expected a write of 7 to key 2, got %+v", txn[1])
+	}
+
+	buf, err := json.Marshal(txn)
+	if err != nil {
+		t.Fatalf("error marshalling txn: %v", err)
+	}
+	if string(buf) != `[["r",1,null],["w",2,7]]` {
+		t.Fatalf("expected txn to marshal back to micro-ops, got %s", buf)
+	}
+}
+
+func TestOpJSONInvalid(t *testing.T) {
+	for _, raw := range []string{`["r", 1]`, `["x", 1, null]`, `["w", 1, null]`, `["r", "a", null]`} {
+		var op Op
+		if err := json.Unmarshal([]byte(raw), &op); err == nil {
+			t.Fatalf("expected an error unmarshalling %s, got %+v", raw, op)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package replog
+
+import (
+	"encoding/json"
+	"log"
+	"maelstrom-shared/logger"
+	"sync"
+	"time"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+// gossipInterval is how often entries are sent on to nodes that haven't
+// acknowledged them.
+const gossipInterval = 100 * time.Millisecond
+
+// maxBatch caps the entries sent to a node in one message.
+const maxBatch = 100
+
+// Log is an append-only log of entries committed on this node, replicated to
+// every other node. It is only ever appended to, so a node's progress is an
+// index into it: each node is sent the suffix it hasn't acknowledged until it
+// does, which covers messages lost on the way or to a partition.
+//
+// Batches and acks are plain messages rather than an RPC and its reply, as
+// an RPC's callback is never cleaned up if the reply doesn't come. Each
+// batch says where in the sender's log it starts, so a receiver applies
+// every entry exactly once and in order, however often it is resent.
+type Log[T any] struct {
+	n *maelstrom.Node
+	// apply hands entries received from another node to the server, in the
+	// order they were appended there.
+	apply func(entries []T)
+
+	mu      sync.RWMutex
+	entries []T
+	// acked maps each node to the length of the prefix of entries they have
+	// acknowledged.
+	acked map[string]int
+
+	// applyMu is held while received entries are applied, so each sender's
+	// entries are applied one batch at a time.
+	applyMu sync.Mutex
+	// applied maps each node to the length of the prefix of their log that
+	// has been applied here.
+	applied map[string]int
+
+	log *log.Logger
+}
+
+func New[T any](n *maelstrom.Node, apply func(entries []T)) *Log[T] {
+	return &Log[T]{
+		n:       n,
+		apply:   apply,
+		acked:   make(map[string]int),
+		applied: make(map[string]int),
+		log:     logger.New(),
+	}
+}
+
+// Append adds entry to the end of the log.
+func (l *Log[T]) Append(entry T) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.entries = append(l.entries, entry)
+}
+
+// Unacked returns up to maxBatch of the entries node hasn't acknowledged yet,
+// oldest first, along with the length of the log up to the last of them.
+func (l *Log[T]) Unacked(node string) ([]T, int) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	start := l.acked[node]
+	end := min(start+maxBatch, len(l.entries))
+
+	return l.entries[start:end], end
+}
+
+// Ack records that node has every entry before end.
+func (l *Log[T]) Ack(node string, end int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.acked[node] = max(l.acked[node], end)
+}
+
+// ReplicateBody carries entries appended on the sender, starting at Start in
+// its log.
+type ReplicateBody[T any] struct {
+	Type    string `json:"type"`
+	Start   int    `json:"start"`
+	Entries []T    `json:"entries"`
+}
+
+// ReplicateOkBody acknowledges every entry before End in the receiver's log.
+type ReplicateOkBody struct {
+	Type string `json:"type"`
+	End  int    `json:"end"`
+}
+
+// HandleReplicate applies the entries in a batch that haven't been applied
+// yet. A batch that starts past what has been applied is dropped, as an
+// earlier one went missing and is sent again before it.
+func (l *Log[T]) HandleReplicate(msg maelstrom.Message) error {
+	var body ReplicateBody[T]
+
+	if err := json.Unmarshal(msg.Body, &body); err != nil {
+		return err
+	}
+
+	l.applyMu.Lock()
+	applied := l.applied[msg.Src]
+	if body.Start <= applied && applied < body.Start+len(body.Entries) {
+		l.apply(body.Entries[applied-body.Start:])
+		applied = body.Start + len(body.Entries)
+		l.applied[msg.Src] = applied
+	}
+	l.applyMu.Unlock()
+
+	return l.n.Send(msg.Src, ReplicateOkBody{
+		Type: "replicate_ok",
+		End:  applied,
+	})
+}
+
+func (l *Log[T]) HandleReplicateOk(msg maelstrom.Message) error {
+	var body ReplicateOkBody
+
+	if err := json.Unmarshal(msg.Body, &body); err != nil {
+		return err
+	}
+
+	l.Ack(msg.Src, body.End)
+
+	return nil
+}
+
+// Gossip starts sending entries to every other node in the background.
+// Every interval each node is sent the next batch it hasn't acknowledged.
+func (l *Log[T]) Gossip() {
+	ticker := time.NewTicker(gossipInterval)
+	go func() {
+		for range ticker.C {
+			l.GossipOnce()
+		}
+	}()
+}
+
+// GossipOnce sends every other node the next batch it hasn't acknowledged.
+func (l *Log[T]) GossipOnce() {
+	for _, node := range l.n.NodeIDs() {
+		if node == l.n.ID() {
+			continue
+		}
+
+		entries, end := l.Unacked(node)
+		if len(entries) == 0 {
+			continue
+		}
+
+		err := l.n.Send(node, ReplicateBody[T]{
+			Type:    "replicate",
+			Start:   end - len(entries),
+			Entries: entries,
+		})
+		if err != nil {
+			l.log.Printf("error replicating to %s: %v", node, err)
+		}
+	}
+}
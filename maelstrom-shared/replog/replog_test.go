@@ -0,0 +1,204 @@
+package replog
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+// applied collects the entries a log hands to the server.
+type applied struct {
+	mu      sync.Mutex
+	entries []int
+}
+
+func (a *applied) apply(entries []int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.entries = append(a.entries, entries...)
+}
+
+func newTestLog(id string) (*Log[int], *applied, *bytes.Buffer) {
+	var out bytes.Buffer
+
+	n := maelstrom.NewNode()
+	n.Init(id, []string{"n0", "n1"})
+	n.Stdout = &out
+
+	a := &applied{}
+	return New(n, a.apply), a, &out
+}
+
+func sent(t *testing.T, out *bytes.Buffer) []maelstrom.Message {
+	msgs := make([]maelstrom.Message, 0)
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		if line == "" {
+			continue
+		}
+
+		var msg maelstrom.Message
+		if err := json.Unmarshal([]byte(line), &msg); err != nil {
+			t.Fatalf("error unmarshalling message: %v", err)
+		}
+		msgs = append(msgs, msg)
+	}
+	out.Reset()
+
+	return msgs
+}
+
+func TestGossipReplicatesEntries(t *testing.T) {
+	l0, _, out0 := newTestLog("n0")
+	l1, a1, out1 := newTestLog("n1")
+
+	l0.Append(1)
+	l0.Append(2)
+
+	l0.GossipOnce()
+	msgs := sent(t, out0)
+	if len(msgs) != 1 || msgs[0].Dest != "n1" {
+		t.Fatalf("expected one replicate message to n1, got %v", msgs)
+	}
+
+	if err := l1.HandleReplicate(msgs[0]); err != nil {
+		t.Fatalf("error handling replicate: %v", err)
+	}
+	if len(a1.entries) != 2 || a1.entries[0] != 1 || a1.entries[1] != 2 {
+		t.Fatalf("expected n1 to apply n0's entries in order, got %v", a1.entries)
+	}
+
+	// until n1 acknowledges them the entries are sent again
+	l0.GossipOnce()
+	if msgs := sent(t, out0); len(msgs) != 1 {
+		t.Fatalf("expected unacknowledged entries to be resent, got %v", msgs)
+	}
+
+	acks := sent(t, out1)
+	if len(acks) != 1 || acks[0].Type() != "replicate_ok" {
+		t.Fatalf("expected one replicate_ok, got %v", acks)
+	}
+	// acks are plain messages, so n0 keeps no callback for ones that are lost
+	var ackBody maelstrom.MessageBody
+	json.Unmarshal(acks[0].Body, &ackBody)
+	if ackBody.InReplyTo != 0 {
+		t.Fatalf("expected replicate_ok to be sent without in_reply_to, got %s", acks[0].Body)
+	}
+	if err := l0.HandleReplicateOk(acks[0]); err != nil {
+		t.Fatalf("error handling replicate_ok: %v", err)
+	}
+
+	l0.GossipOnce()
+	if out0.Len() != 0 {
+		t.Fatalf("expected nothing to be sent once n1 has acknowledged everything, got %s", out0)
+	}
+
+	// only entries appended since are sent
+	l0.Append(3)
+	if entries, _ := l0.Unacked("n1"); len(entries) != 1 || entries[0] != 3 {
+		t.Fatalf("expected only the new entry to be unacknowledged, got %v", entries)
+	}
+}
+
+func TestReplicateAppliesEachEntryOnce(t *testing.T) {
+	l0, _, out0 := newTestLog("n0")
+	l1, a1, out1 := newTestLog("n1")
+
+	l0.Append(1)
+	l0.GossipOnce()
+	first := sent(t, out0)
+
+	l0.Append(2)
+	l0.GossipOnce()
+	second := sent(t, out0)
+
+	// the second batch overlaps the first, and arrives first and twice
+	for _, msg := range append(append(second, second...), first...) {
+		if err := l1.HandleReplicate(msg); err != nil {
+			t.Fatalf("error handling replicate: %v", err)
+		}
+	}
+	if len(a1.entries) != 2 || a1.entries[0] != 1 || a1.entries[1] != 2 {
+		t.Fatalf("expected n1 to apply each entry once and in order, got %v", a1.entries)
+	}
+
+	// every ack carries how much of n0's log n1 has applied
+	for _, ack := range sent(t, out1) {
+		if err := l0.HandleReplicateOk(ack); err != nil {
+			t.Fatalf("error handling replicate_ok: %v", err)
+		}
+	}
+	if entries, end := l0.Unacked("n1"); len(entries) != 0 || end != 2 {
+		t.Fatalf("expected nothing unacknowledged, got %v up to %d", entries, end)
+	}
+}
+
+func TestReplicateDropsBatchesAfterAGap(t *testing.T) {
+	l0, _, out0 := newTestLog("n0")
+	l1, a1, out1 := newTestLog("n1")
+
+	l0.Append(1)
+	l0.GossipOnce()
+	sent(t, out0)
+
+	// n1 never got the first batch, so hasn't acknowledged it, but a later
+	// one starting after it reaches n1
+	body, _ := json.Marshal(ReplicateBody[int]{Type: "replicate", Start: 1, Entries: []int{2}})
+	if err := l1.HandleReplicate(maelstrom.Message{Src: "n0", Dest: "n1", Body: body}); err != nil {
+		t.Fatalf("error handling replicate: %v", err)
+	}
+	if len(a1.entries) != 0 {
+		t.Fatalf("expected entries after a gap to be dropped, got %v", a1.entries)
+	}
+
+	acks := sent(t, out1)
+	if err := l0.HandleReplicateOk(acks[0]); err != nil {
+		t.Fatalf("error handling replicate_ok: %v", err)
+	}
+	if entries, _ := l0.Unacked("n1"); len(entries) != 1 || entries[0] != 1 {
+		t.Fatalf("expected the missing entry to be sent again, got %v", entries)
+	}
+}
+
+func TestGossipCapsBatches(t *testing.T) {
+	l0, _, out0 := newTestLog("n0")
+
+	for i := 0; i < maxBatch+1; i++ {
+		l0.Append(i)
+	}
+
+	l0.GossipOnce()
+	msgs := sent(t, out0)
+
+	var body ReplicateBody[int]
+	if err := json.Unmarshal(msgs[0].Body, &body); err != nil {
+		t.Fatalf("error unmarshalling replicate: %v", err)
+	}
+	if body.Start != 0 || len(body.Entries) != maxBatch {
+		t.Fatalf("expected a batch of %d entries from 0, got %d from %d", maxBatch, len(body.Entries), body.Start)
+	}
+
+	l0.Ack("n1", maxBatch)
+	if entries, end := l0.Unacked("n1"); len(entries) != 1 || end != maxBatch+1 {
+		t.Fatalf("expected the rest in the next batch, got %v up to %d", entries, end)
+	}
+}
+
+func TestAckNeverGoesBack(t *testing.T) {
+	l, _, _ := newTestLog("n0")
+
+	l.Append(1)
+	l.Append(2)
+
+	// a late reply to an older gossip round mustn't undo a newer ack
+	l.Ack("n1", 2)
+	l.Ack("n1", 1)
+
+	if entries, end := l.Unacked("n1"); len(entries) != 0 || end != 2 {
+		t.Fatalf("expected nothing unacknowledged, got %v up to %d", entries, end)
+	}
+}
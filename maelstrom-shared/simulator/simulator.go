@@ -0,0 +1,462 @@
+// Package simulator runs Maelstrom nodes in-process for tests. Every node is
+// a real *maelstrom.Node whose stdin and stdout are wired to an in-memory
+// network, so servers are tested through their handlers exactly as Maelstrom
+// drives them, without the JVM or a process per node.
+//
+// The network can delay, drop and partition messages between nodes, and it
+// answers seq-kv, lin-kv and lww-kv requests from in-memory stores. Its
+// random choices come from Config.Seed, so a run's faults can be replayed,
+// though goroutine scheduling still varies from run to run.
+package simulator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+
+	"maelstrom-shared/kv"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+// ClientId is the source of every request sent with Network.RPC.
+const ClientId = "c1"
+
+// Config tunes how the network treats messages.
+type Config struct {
+	// Latency is how long every message takes to arrive.
+	Latency time.Duration
+	// Jitter adds up to this much on top of Latency, picked per message, so
+	// messages can overtake each other.
+	Jitter time.Duration
+	// DropRate is the chance a message between two nodes is lost. Messages
+	// to and from clients and kv services are never dropped.
+	DropRate float64
+	// KVLag is how many writes behind the latest seq-kv and lww-kv reads
+	// are. lin-kv reads are always up to date.
+	KVLag int
+	// Seed seeds the latency and drop choices.
+	Seed int64
+}
+
+// Stats counts what has happened to messages between nodes.
+type Stats struct {
+	Sent        int
+	Dropped     int
+	Partitioned int
+}
+
+type Network struct {
+	cfg Config
+
+	nodeIds []string
+	nodes   map[string]*maelstrom.Node
+	inboxes map[string]*inbox
+	kvs     map[string]*kv.Memory
+
+	mu   sync.Mutex
+	rand *rand.Rand
+	// groups maps each node to its side of a partition. Nodes can only
+	// talk to nodes on the same side.
+	groups  map[string]int
+	stats   Stats
+	stopped bool
+
+	clientMu  sync.Mutex
+	nextMsgId int
+	pending   map[int]chan maelstrom.Message
+
+	// runs finishes once every node's Run has returned
+	runs sync.WaitGroup
+}
+
+// New builds a network of nodes with the given IDs. Register handlers on
+// them with Node before calling Start.
+func New(nodeIds []string, cfg Config) *Network {
+	net := &Network{
+		cfg:     cfg,
+		nodeIds: nodeIds,
+		nodes:   make(map[string]*maelstrom.Node),
+		inboxes: make(map[string]*inbox),
+		kvs: map[string]*kv.Memory{
+			maelstrom.LinKV: kv.NewLinKV(),
+			maelstrom.SeqKV: kv.NewSeqKV(cfg.KVLag),
+			maelstrom.LWWKV: kv.NewSeqKV(cfg.KVLag),
+		},
+		rand:    rand.New(rand.NewSource(cfg.Seed)),
+		groups:  make(map[string]int),
+		pending: make(map[int]chan maelstrom.Message),
+	}
+
+	for _, id := range nodeIds {
+		in := newInbox()
+
+		n := maelstrom.NewNode()
+		n.Stdin = in.r
+		n.Stdout = &lineWriter{route: net.route}
+
+		net.nodes[id] = n
+		net.inboxes[id] = in
+	}
+
+	return net
+}
+
+// Node returns the node with the given ID.
+func (net *Network) Node(id string) *maelstrom.Node {
+	return net.nodes[id]
+}
+
+// KV returns the store behind a kv service, maelstrom.SeqKV, LinKV or
+// LWWKV, so that tests can inspect it or inject failures.
+func (net *Network) KV(name string) *kv.Memory {
+	return net.kvs[name]
+}
+
+// Start runs every node and sends it an init message, returning once they
+// have all replied.
+func (net *Network) Start(ctx context.Context) error {
+	for _, id := range net.nodeIds {
+		n := net.nodes[id]
+
+		net.runs.Add(1)
+		go func() {
+			defer net.runs.Done()
+			n.Run()
+		}()
+	}
+
+	for _, id := range net.nodeIds {
+		_, err := net.RPC(ctx, id, maelstrom.InitMessageBody{
+			MessageBody: maelstrom.MessageBody{Type: "init"},
+			NodeID:      id,
+			NodeIDs:     net.nodeIds,
+		})
+		if err != nil {
+			return fmt.Errorf("init %s: %w", id, err)
+		}
+	}
+
+	return nil
+}
+
+// Stop closes every node's stdin and waits for their handlers to finish, so
+// a handler still waiting on a reply keeps it waiting until its context
+// runs out. Messages sent after Stop are thrown away.
+func (net *Network) Stop() {
+	net.mu.Lock()
+	net.stopped = true
+	for _, in := range net.inboxes {
+		in.close()
+	}
+	net.mu.Unlock()
+
+	net.runs.Wait()
+}
+
+// Partition splits the nodes into groups that can only talk among
+// themselves. Nodes left out of every group form one more group together.
+func (net *Network) Partition(groups ...[]string) {
+	net.mu.Lock()
+	defer net.mu.Unlock()
+
+	net.groups = make(map[string]int)
+	for i, group := range groups {
+		for _, id := range group {
+			net.groups[id] = i + 1
+		}
+	}
+}
+
+// Heal removes any partition.
+func (net *Network) Heal() {
+	net.Partition()
+}
+
+func (net *Network) Stats() Stats {
+	net.mu.Lock()
+	defer net.mu.Unlock()
+
+	return net.stats
+}
+
+// RPC sends body to dest as a client and waits for the reply. A reply that
+// is an error comes back as an *maelstrom.RPCError.
+func (net *Network) RPC(ctx context.Context, dest string, body any) (maelstrom.Message, error) {
+	b := make(map[string]any)
+	if buf, err := json.Marshal(body); err != nil {
+		return maelstrom.Message{}, err
+	} else if err := json.Unmarshal(buf, &b); err != nil {
+		return maelstrom.Message{}, err
+	}
+
+	net.clientMu.Lock()
+	net.nextMsgId++
+	msgId := net.nextMsgId
+	ch := make(chan maelstrom.Message, 1)
+	net.pending[msgId] = ch
+	net.clientMu.Unlock()
+
+	defer func() {
+		net.clientMu.Lock()
+		delete(net.pending, msgId)
+		net.clientMu.Unlock()
+	}()
+
+	b["msg_id"] = msgId
+	if err := net.send(ClientId, dest, b); err != nil {
+		return maelstrom.Message{}, err
+	}
+
+	select {
+	case <-ctx.Done():
+		return maelstrom.Message{}, ctx.Err()
+	case msg := <-ch:
+		return msg, replyError(msg)
+	}
+}
+
+// replyError returns the error in an error reply. Unlike msg.RPCError it
+// doesn't take a code of 0, a timeout, to mean success.
+func replyError(msg maelstrom.Message) error {
+	var body maelstrom.MessageBody
+	if err := json.Unmarshal(msg.Body, &body); err != nil {
+		return err
+	}
+	if body.Type != "error" {
+		return nil
+	}
+
+	return maelstrom.NewRPCError(body.Code, body.Text)
+}
+
+func (net *Network) send(src, dest string, body any) error {
+	bodyJSON, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	buf, err := json.Marshal(maelstrom.Message{Src: src, Dest: dest, Body: bodyJSON})
+	if err != nil {
+		return err
+	}
+
+	net.route(buf)
+	return nil
+}
+
+// route decides the fate of a message a node, client or service has sent.
+func (net *Network) route(line []byte) {
+	var msg maelstrom.Message
+	if err := json.Unmarshal(line, &msg); err != nil {
+		return
+	}
+
+	net.mu.Lock()
+	defer net.mu.Unlock()
+
+	if net.stopped {
+		return
+	}
+
+	_, fromNode := net.nodes[msg.Src]
+	_, toNode := net.nodes[msg.Dest]
+	if fromNode && toNode {
+		net.stats.Sent++
+
+		if net.groups[msg.Src] != net.groups[msg.Dest] {
+			net.stats.Partitioned++
+			return
+		}
+		if net.rand.Float64() < net.cfg.DropRate {
+			net.stats.Dropped++
+			return
+		}
+	}
+
+	delay := net.cfg.Latency
+	if net.cfg.Jitter > 0 {
+		delay += time.Duration(net.rand.Int63n(int64(net.cfg.Jitter)))
+	}
+
+	time.AfterFunc(delay, func() {
+		net.deliver(msg, line)
+	})
+}
+
+func (net *Network) deliver(msg maelstrom.Message, line []byte) {
+	if in, ok := net.inboxes[msg.Dest]; ok {
+		in.push(line)
+		return
+	}
+
+	if store, ok := net.kvs[msg.Dest]; ok {
+		go net.serveKV(store, msg)
+		return
+	}
+
+	if msg.Dest == ClientId {
+		var body maelstrom.MessageBody
+		if err := json.Unmarshal(msg.Body, &body); err != nil {
+			return
+		}
+
+		net.clientMu.Lock()
+		ch, ok := net.pending[body.InReplyTo]
+		net.clientMu.Unlock()
+		if ok {
+			ch <- msg
+		}
+	}
+}
+
+// kvBody is any request to a kv service.
+type kvBody struct {
+	maelstrom.MessageBody
+	Key               string `json:"key"`
+	Value             any    `json:"value"`
+	From              any    `json:"from"`
+	To                any    `json:"to"`
+	CreateIfNotExists bool   `json:"create_if_not_exists"`
+}
+
+func (net *Network) serveKV(store *kv.Memory, msg maelstrom.Message) {
+	var body kvBody
+	if err := json.Unmarshal(msg.Body, &body); err != nil {
+		return
+	}
+
+	ctx := context.Background()
+	out := map[string]any{"in_reply_to": body.MsgID}
+
+	var err error
+	switch body.Type {
+	case "read":
+		var val any
+		if val, err = store.Read(ctx, body.Key); err == nil {
+			out["type"] = "read_ok"
+			out["value"] = val
+		}
+	case "write":
+		if err = store.Write(ctx, body.Key, body.Value); err == nil {
+			out["type"] = "write_ok"
+		}
+	case "cas":
+		if err = store.CompareAndSwap(ctx, body.Key, body.From, body.To, body.CreateIfNotExists); err == nil {
+			out["type"] = "cas_ok"
+		}
+	default:
+		err = maelstrom.NewRPCError(maelstrom.NotSupported, fmt.Sprintf("unknown kv operation %q", body.Type))
+	}
+
+	if err != nil {
+		rpcErr, ok := err.(*maelstrom.RPCError)
+		if !ok {
+			rpcErr = maelstrom.NewRPCError(maelstrom.Crash, err.Error())
+		}
+		out["type"] = "error"
+		out["code"] = rpcErr.Code
+		out["text"] = rpcErr.Text
+	}
+
+	net.send(msg.Dest, msg.Src, out)
+}
+
+// inbox feeds a node's stdin one line at a time, in the order they were
+// pushed, without making the sender wait for the node to read them.
+type inbox struct {
+	r *io.PipeReader
+	w *io.PipeWriter
+
+	mu     sync.Mutex
+	lines  [][]byte
+	ready  chan struct{}
+	closed bool
+}
+
+func newInbox() *inbox {
+	r, w := io.Pipe()
+	in := &inbox{r: r, w: w, ready: make(chan struct{}, 1)}
+
+	go in.run()
+	return in
+}
+
+func (in *inbox) push(line []byte) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+
+	if in.closed {
+		return
+	}
+	in.lines = append(in.lines, line)
+
+	select {
+	case in.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (in *inbox) close() {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+
+	in.closed = true
+
+	select {
+	case in.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (in *inbox) run() {
+	for range in.ready {
+		in.mu.Lock()
+		lines, closed := in.lines, in.closed
+		in.lines = nil
+		in.mu.Unlock()
+
+		for _, line := range lines {
+			if _, err := in.w.Write(append(line, '\n')); err != nil {
+				return
+			}
+		}
+
+		if closed {
+			in.w.Close()
+			return
+		}
+	}
+}
+
+// lineWriter is a node's stdout. The node writes a message and its newline
+// separately, so it waits for whole lines before routing them.
+type lineWriter struct {
+	mu    sync.Mutex
+	buf   bytes.Buffer
+	route func(line []byte)
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf.Write(p)
+	for {
+		i := bytes.IndexByte(w.buf.Bytes(), '\n')
+		if i < 0 {
+			break
+		}
+
+		line := make([]byte, i)
+		copy(line, w.buf.Next(i+1))
+		w.route(line)
+	}
+
+	return len(p), nil
+}
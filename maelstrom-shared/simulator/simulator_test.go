@@ -0,0 +1,160 @@
+package simulator
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+var nodeIds = []string{"n0", "n1", "n2"}
+
+// newRelayNetwork starts nodes that answer "echo" themselves and answer
+// "relay" by echoing through the node named in the request.
+func newRelayNetwork(t *testing.T, cfg Config) *Network {
+	net := New(nodeIds, cfg)
+
+	for _, id := range nodeIds {
+		n := net.Node(id)
+
+		n.Handle("echo", func(msg maelstrom.Message) error {
+			return n.Reply(msg, map[string]any{"type": "echo_ok", "from": n.ID()})
+		})
+
+		n.Handle("relay", func(msg maelstrom.Message) error {
+			var body struct {
+				Via string
+			}
+			if err := json.Unmarshal(msg.Body, &body); err != nil {
+				return err
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+
+			res, err := n.SyncRPC(ctx, body.Via, map[string]any{"type": "echo"})
+			if err != nil {
+				return maelstrom.NewRPCError(maelstrom.TemporarilyUnavailable, err.Error())
+			}
+			return n.Reply(msg, map[string]any{"type": "relay_ok", "reply": res.Body})
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := net.Start(ctx); err != nil {
+		t.Fatalf("error starting network: %v", err)
+	}
+	t.Cleanup(net.Stop)
+
+	return net
+}
+
+func relay(net *Network, dest, via string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	_, err := net.RPC(ctx, dest, map[string]any{"type": "relay", "via": via})
+	return err
+}
+
+func TestNetworkRPC(t *testing.T) {
+	net := newRelayNetwork(t, Config{Latency: time.Millisecond, Jitter: time.Millisecond})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	res, err := net.RPC(ctx, "n1", map[string]any{"type": "echo"})
+	if err != nil {
+		t.Fatalf("error sending echo: %v", err)
+	}
+	if res.Type() != "echo_ok" || res.Src != "n1" {
+		t.Fatalf("expected echo_ok from n1, got %v", res)
+	}
+
+	if err := relay(net, "n0", "n2"); err != nil {
+		t.Fatalf("error relaying between nodes: %v", err)
+	}
+	if stats := net.Stats(); stats.Sent != 2 {
+		t.Fatalf("expected %d messages between nodes, got %+v", 2, stats)
+	}
+}
+
+func TestNetworkPartition(t *testing.T) {
+	net := newRelayNetwork(t, Config{})
+
+	net.Partition([]string{"n0"})
+
+	if err := relay(net, "n0", "n1"); maelstrom.ErrorCode(err) != maelstrom.TemporarilyUnavailable {
+		t.Fatalf("expected the relay to fail across the partition, got %v", err)
+	}
+	if err := relay(net, "n1", "n2"); err != nil {
+		t.Fatalf("expected nodes on the same side to talk, got %v", err)
+	}
+	if stats := net.Stats(); stats.Partitioned != 1 {
+		t.Fatalf("expected %d message lost to the partition, got %+v", 1, stats)
+	}
+
+	net.Heal()
+
+	if err := relay(net, "n0", "n1"); err != nil {
+		t.Fatalf("expected the partition to heal, got %v", err)
+	}
+}
+
+func TestNetworkDrops(t *testing.T) {
+	net := newRelayNetwork(t, Config{DropRate: 1})
+
+	if err := relay(net, "n0", "n1"); maelstrom.ErrorCode(err) != maelstrom.TemporarilyUnavailable {
+		t.Fatalf("expected every message between nodes to be dropped, got %v", err)
+	}
+	if stats := net.Stats(); stats.Dropped != 1 {
+		t.Fatalf("expected %d dropped message, got %+v", 1, stats)
+	}
+}
+
+func TestNetworkKV(t *testing.T) {
+	net := New([]string{"n0"}, Config{})
+	n := net.Node("n0")
+	store := maelstrom.NewLinKV(n)
+
+	n.Handle("incr", func(msg maelstrom.Message) error {
+		ctx := context.Background()
+
+		val, err := store.ReadInt(ctx, "x")
+		if err != nil && maelstrom.ErrorCode(err) != maelstrom.KeyDoesNotExist {
+			return err
+		}
+		if err := store.CompareAndSwap(ctx, "x", val, val+1, true); err != nil {
+			return err
+		}
+		return n.Reply(msg, map[string]any{"type": "incr_ok"})
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := net.Start(ctx); err != nil {
+		t.Fatalf("error starting network: %v", err)
+	}
+	defer net.Stop()
+
+	for i := 0; i < 3; i++ {
+		if _, err := net.RPC(ctx, "n0", map[string]any{"type": "incr"}); err != nil {
+			t.Fatalf("error incrementing: %v", err)
+		}
+	}
+
+	val, err := net.KV(maelstrom.LinKV).ReadInt(ctx, "x")
+	if err != nil || val != 3 {
+		t.Fatalf("expected x to be %d, got %d (%v)", 3, val, err)
+	}
+
+	// errors from the service reach the node with their code
+	net.KV(maelstrom.LinKV).FailNext(maelstrom.NewRPCError(maelstrom.PreconditionFailed, "injected"))
+	_, err = net.RPC(ctx, "n0", map[string]any{"type": "incr"})
+	if maelstrom.ErrorCode(err) != maelstrom.PreconditionFailed {
+		t.Fatalf("expected the injected error to come back, got %v", err)
+	}
+}
@@ -0,0 +1,353 @@
+package snowflake
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SkewPolicy decides what a Worker does when the clock moves backwards.
+type SkewPolicy int
+
+const (
+	// SkewFail returns an error on any backwards step of the clock.
+	SkewFail SkewPolicy = iota
+	// SkewWait sleeps until the clock has caught up with the last timestamp.
+	SkewWait
+	// SkewBorrow keeps issuing IDs from the last timestamp, moving it forward
+	// by a millisecond whenever its sequence space runs out.
+	SkewBorrow
+)
+
+// Config sets the bit layout of generated IDs and the epoch their
+// timestamps count from. The three widths must add up to at most 64 bits.
+type Config struct {
+	TimestampBits uint
+	NodeIdBits    uint
+	SequenceBits  uint
+
+	Epoch time.Time
+}
+
+// DefaultConfig gives 42 bits of milliseconds since 2024-01-01, 1024 nodes
+// and 4096 IDs per node per millisecond.
+var DefaultConfig = Config{
+	TimestampBits: 42,
+	NodeIdBits:    10,
+	SequenceBits:  12,
+	Epoch:         time.UnixMilli(1704067200000),
+}
+
+func (c Config) validate() error {
+	if c.TimestampBits == 0 {
+		return fmt.Errorf("invalid config: timestamp bits cannot be zero")
+	}
+	if c.SequenceBits == 0 {
+		return fmt.Errorf("invalid config: sequence bits cannot be zero")
+	}
+	if total := c.TimestampBits + c.NodeIdBits + c.SequenceBits; total > 64 {
+		return fmt.Errorf("invalid config: layout needs %d bits, only 64 are available", total)
+	}
+
+	return nil
+}
+
+// Parts are the fields packed into an ID.
+type Parts struct {
+	// Timestamp is in milliseconds since the epoch of the layout.
+	Timestamp int64
+	NodeId    int64
+	Sequence  int64
+
+	// Time is Timestamp converted back to wall-clock time.
+	Time time.Time
+}
+
+// Decode splits an ID generated with this layout back into its parts.
+func (c Config) Decode(id uint64) Parts {
+	timestamp := int64(id >> (c.NodeIdBits + c.SequenceBits))
+
+	return Parts{
+		Timestamp: timestamp,
+		NodeId:    int64(id>>c.SequenceBits) & bitMask(c.NodeIdBits),
+		Sequence:  int64(id) & bitMask(c.SequenceBits),
+		Time:      c.Epoch.Add(time.Duration(timestamp) * time.Millisecond),
+	}
+}
+
+// Decode splits an ID generated with DefaultConfig back into its parts.
+func Decode(id uint64) Parts {
+	return DefaultConfig.Decode(id)
+}
+
+type Worker struct {
+	mu sync.Mutex
+
+	cfg Config
+
+	nodeId   int64
+	sequence int64
+
+	sequenceMask   int64
+	maxTimestamp   int64
+	nodeIdShift    uint
+	timestampShift uint
+	epoch          int64
+
+	lastTimestamp int64
+	// logical is the highest timestamp we have moved to because of an
+	// observed ID rather than the clock. While lastTimestamp is no later
+	// than it, being ahead of the clock isn't skew.
+	logical int64
+
+	skewPolicy SkewPolicy
+	maxSkew    int64
+
+	clock func() int64
+	sleep func(time.Duration)
+}
+
+func NewWorker(nodeId int64) (*Worker, error) {
+	return NewWorkerWithConfig(nodeId, DefaultConfig)
+}
+
+// NewWorkerWithConfig creates a worker that lays its IDs out as described by
+// cfg.
+func NewWorkerWithConfig(nodeId int64, cfg Config) (*Worker, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	if 0 > nodeId {
+		return nil, fmt.Errorf("invalid node ID={%d}: cannot be negative", nodeId)
+	}
+	if maxNodeId := bitMask(cfg.NodeIdBits); nodeId > maxNodeId {
+		return nil, fmt.Errorf("invalid node ID={%d}: cluster is too big for %d node bits", nodeId, cfg.NodeIdBits)
+	}
+
+	return &Worker{
+		cfg:            cfg,
+		nodeId:         nodeId,
+		sequence:       0,
+		sequenceMask:   bitMask(cfg.SequenceBits),
+		maxTimestamp:   bitMask(cfg.TimestampBits),
+		nodeIdShift:    cfg.SequenceBits,
+		timestampShift: cfg.NodeIdBits + cfg.SequenceBits,
+		epoch:          cfg.Epoch.UnixMilli(),
+		lastTimestamp:  0,
+		skewPolicy:     SkewFail,
+		clock:          timeGen,
+		sleep:          time.Sleep,
+	}, nil
+}
+
+// NewWorkerForNode creates a worker whose node ID is taken from a Maelstrom
+// node ID such as "n3". Distinct nodes in a cluster always get distinct IDs.
+func NewWorkerForNode(id string) (*Worker, error) {
+	nodeId, err := ParseNodeId(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewWorker(nodeId)
+}
+
+// ParseNodeId converts a Maelstrom node ID like "n3" into its number.
+func ParseNodeId(id string) (int64, error) {
+	num, ok := strings.CutPrefix(id, "n")
+	if !ok {
+		return 0, fmt.Errorf("invalid node ID={%s}: expected an n prefix", id)
+	}
+
+	nodeId, err := strconv.ParseInt(num, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid node ID={%s}: %w", id, err)
+	}
+	if nodeId < 0 {
+		return 0, fmt.Errorf("invalid node ID={%s}: cannot be negative", id)
+	}
+
+	return nodeId, nil
+}
+
+// Decode splits an ID generated by this worker back into its parts.
+func (w *Worker) Decode(id uint64) Parts {
+	return w.cfg.Decode(id)
+}
+
+// SetSkewPolicy configures how the worker handles the clock moving
+// backwards. Regressions larger than maxSkew always fail, whatever the
+// policy.
+func (w *Worker) SetSkewPolicy(policy SkewPolicy, maxSkew time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.skewPolicy = policy
+	w.maxSkew = maxSkew.Milliseconds()
+}
+
+// bitMask returns the largest value that fits in bits bits, capped at the
+// largest int64.
+func bitMask(bits uint) int64 {
+	if bits >= 63 {
+		return -1 ^ (-1 << 63)
+	}
+	return -1 ^ (-1 << bits)
+}
+
+func (w *Worker) NextId() (uint64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.nextId()
+}
+
+// MaxRun caps how many IDs NextIds hands out in one go. The worker is locked
+// for the whole run, sleeping whenever a millisecond's sequence runs out, so
+// a larger run would hold up every other caller for too long.
+const MaxRun = 10_000
+
+// NextIds returns count IDs generated in one go. No other caller can take an
+// ID from the middle of the run, so they are consecutive in ID order.
+func (w *Worker) NextIds(count int) ([]uint64, error) {
+	if count < 0 {
+		return nil, fmt.Errorf("invalid count={%d}: cannot be negative", count)
+	}
+	if count > MaxRun {
+		return nil, fmt.Errorf("invalid count={%d}: cannot be more than %d", count, MaxRun)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	ids := make([]uint64, count)
+	for i := range ids {
+		id, err := w.nextId()
+		if err != nil {
+			return nil, err
+		}
+		ids[i] = id
+	}
+
+	return ids, nil
+}
+
+// Observe moves the worker past id, typically one generated by another
+// node, so that every ID it generates afterwards is larger. Used on every
+// ID a node receives, this makes IDs Lamport timestamps: an ID is always
+// larger than the IDs of everything that happened before it. If id is ahead
+// of our clock, the worker borrows timestamps from the future until the
+// clock catches up, whatever the skew policy.
+func (w *Worker) Observe(id uint64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if id <= w.lastId() {
+		return
+	}
+
+	// the next ID has to be in a later millisecond, as within this one
+	// the node ID bits could put ours below id whatever our sequence
+	w.lastTimestamp = w.cfg.Decode(id).Timestamp + w.epoch
+	w.sequence = w.sequenceMask
+	w.logical = w.lastTimestamp
+}
+
+// lastId returns the last ID generated, or 0 if there hasn't been one.
+func (w *Worker) lastId() uint64 {
+	elapsed := w.lastTimestamp - w.epoch
+	if elapsed < 0 {
+		return 0
+	}
+
+	return (uint64(elapsed) << w.timestampShift) |
+		(uint64(w.nodeId) << w.nodeIdShift) |
+		uint64(w.sequence)
+}
+
+func (w *Worker) nextId() (uint64, error) {
+	timestamp := w.clock()
+	// ahead is set when we're ahead of the clock because of Observe
+	ahead := w.logical > 0 && w.lastTimestamp <= w.logical
+
+	if timestamp < w.lastTimestamp {
+		if ahead {
+			timestamp = w.lastTimestamp
+		} else {
+			var err error
+			timestamp, err = w.handleSkew(timestamp)
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	if w.lastTimestamp == timestamp {
+		w.sequence = (w.sequence + 1) & w.sequenceMask
+
+		if w.sequence == 0 {
+			if (ahead || w.skewPolicy == SkewBorrow) && w.clock() <= w.lastTimestamp {
+				timestamp = w.lastTimestamp + 1
+				if ahead {
+					w.logical = timestamp
+				}
+			} else {
+				timestamp = w.nextMillis(w.lastTimestamp)
+			}
+		}
+	} else {
+		w.sequence = 0
+	}
+
+	w.lastTimestamp = timestamp
+
+	elapsed := timestamp - w.epoch
+	if elapsed < 0 {
+		return 0, fmt.Errorf("timestamp %d is before the epoch %d", timestamp, w.epoch)
+	}
+	if elapsed > w.maxTimestamp {
+		return 0, fmt.Errorf("timestamp %d has outgrown the timestamp bits", timestamp)
+	}
+
+	id := (uint64(elapsed) << w.timestampShift) |
+		(uint64(w.nodeId) << w.nodeIdShift) |
+		uint64(w.sequence)
+
+	return id, nil
+}
+
+// handleSkew applies the skew policy to a timestamp that is behind the last
+// one used, returning the timestamp to generate the next ID with.
+func (w *Worker) handleSkew(timestamp int64) (int64, error) {
+	skew := w.lastTimestamp - timestamp
+	if w.skewPolicy == SkewFail || skew > w.maxSkew {
+		return 0, fmt.Errorf("time is moving backwards: %dms behind last timestamp", skew)
+	}
+
+	switch w.skewPolicy {
+	case SkewWait:
+		for timestamp < w.lastTimestamp {
+			w.sleep(time.Duration(w.lastTimestamp-timestamp) * time.Millisecond)
+			timestamp = w.clock()
+		}
+		return timestamp, nil
+	default:
+		return w.lastTimestamp, nil
+	}
+}
+
+// nextMillis sleeps until the clock has moved past lastTimestamp.
+func (w *Worker) nextMillis(lastTimestamp int64) int64 {
+	timestamp := w.clock()
+	for timestamp <= lastTimestamp {
+		w.sleep(time.Duration(lastTimestamp-timestamp+1) * time.Millisecond)
+		timestamp = w.clock()
+	}
+	return timestamp
+}
+
+func timeGen() int64 {
+	return time.Now().UnixMilli()
+}
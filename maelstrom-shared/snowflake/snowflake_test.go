@@ -0,0 +1,616 @@
+package snowflake
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSnowflake_NextId(t *testing.T) {
+	t.Run("Generates positive Ids", func(t *testing.T) {
+		w, _ := NewWorker(1)
+
+		id, err := w.NextId()
+
+		if err != nil {
+			t.Fatalf("Error getting next Id: %v", err)
+		}
+
+		if id < 0 {
+			t.Fatalf("Id expected to be positive, was %d", id)
+		}
+
+	})
+
+	t.Run("Generate Ids", func(t *testing.T) {
+		w, _ := NewWorker(1)
+
+		length := 100
+		ids := make([]uint64, 0)
+		idSet := make(map[uint64]struct{})
+
+		for i := 0; i < length; i++ {
+			nextId, err := w.NextId()
+
+			if err != nil {
+				t.Fatalf("Error getting next Id: %v", err)
+			}
+
+			ids = append(ids, nextId)
+			idSet[nextId] = struct{}{}
+		}
+
+		if len(idSet) != length {
+			t.Fatalf("Did not generate unique Ids. Expected %d, got %d", length, len(idSet))
+		}
+	})
+
+	t.Run("Generates unique Ids for two nodes", func(t *testing.T) {
+		w1, _ := NewWorker(1)
+		w2, _ := NewWorker(2)
+
+		length := 100
+		w1Ids := make([]uint64, length)
+		w2Ids := make([]uint64, length)
+		idSet := make(map[uint64]struct{})
+
+		for i := 0; i < length; i++ {
+			nextId1, err := w1.NextId()
+			if err != nil {
+				t.Fatalf("Error getting next Id: %v", err)
+			}
+
+			w1Ids[i] = nextId1
+
+			nextId2, err := w2.NextId()
+			if err != nil {
+				t.Fatalf("Error getting next Id: %v", err)
+			}
+
+			w2Ids[i] = nextId2
+
+			idSet[nextId1] = struct{}{}
+			idSet[nextId2] = struct{}{}
+		}
+
+		if len(idSet) != 2*length {
+			t.Fatalf("Did not generate unique Ids. Expected %d, got %d", 2*length, len(idSet))
+		}
+	})
+
+	t.Run("More concurrent Id generation?", func(t *testing.T) {
+		w1, _ := NewWorker(1)
+		w2, _ := NewWorker(2)
+		w3, _ := NewWorker(3)
+
+		length := 100
+		w1Ids := make([]uint64, length)
+		w2Ids := make([]uint64, length)
+		w3Ids := make([]uint64, length)
+
+		var wg sync.WaitGroup
+		incrementer := func(gen *Worker, idList *[]uint64, id int) {
+			defer wg.Done()
+			for i := 0; i < length; i++ {
+				nextId, err := gen.NextId()
+
+				if err != nil {
+					fmt.Printf("Error getting next Id: %v\n", err)
+					continue
+				}
+				(*idList)[i] = nextId
+			}
+		}
+
+		wg.Add(3)
+		go incrementer(w1, &w1Ids, 1)
+		go incrementer(w2, &w2Ids, 2)
+		go incrementer(w3, &w3Ids, 3)
+		wg.Wait()
+
+		if length != len(w1Ids) {
+			t.Fatalf("Didn't generate enough Ids for list 1, expected %d, got %d", length, len(w1Ids))
+		}
+		if length != len(w2Ids) {
+			t.Fatalf("Didn't generate enough Ids for list 2, expected %d, got %d", length, len(w2Ids))
+		}
+		if length != len(w3Ids) {
+			t.Fatalf("Didn't generate enough Ids for list 3, expected %d, got %d", length, len(w3Ids))
+		}
+
+		idSet := make(map[uint64]int)
+
+		for i := 0; i < length; i++ {
+			prev, _ := idSet[w1Ids[i]]
+			idSet[w1Ids[i]] = prev + 1
+
+			prev, _ = idSet[w2Ids[i]]
+			idSet[w2Ids[i]] = prev + 100
+
+			prev, _ = idSet[w3Ids[i]]
+			idSet[w3Ids[i]] = prev + 100_000
+		}
+
+		if len(idSet) != 3*length {
+			for key, value := range idSet {
+				if value != 1 && value != 100 && value != 100_000 {
+					fmt.Printf("Duplicated id: %d, %d\n", key, value)
+				}
+			}
+			t.Fatalf("Generated duplicate IDs. Expected %d Ids, got %d", 3*length, len(idSet))
+		}
+	})
+
+	t.Run("One generator, lots of ids", func(t *testing.T) {
+		w, _ := NewWorker(5)
+
+		var wg sync.WaitGroup
+		count := 10_000
+		ch := make(chan uint64, count)
+		wg.Add(count)
+		defer close(ch)
+
+		for i := 0; i < count; i++ {
+			go func() {
+				defer wg.Done()
+				id, _ := w.NextId()
+				ch <- id
+			}()
+		}
+		wg.Wait()
+
+		ids := make(map[uint64]int)
+
+		for i := 0; i < count; i++ {
+			id := <-ch
+			prev, _ := ids[id]
+
+			ids[id] = prev + 1
+		}
+
+		if len(ids) != count {
+			for key, val := range ids {
+				if val > 1 {
+					fmt.Printf("Duplicate key: %d\n", key)
+				}
+
+			}
+			t.Fatalf("Repeated IDs, expected: %d, got: %d", count, len(ids))
+		}
+
+	})
+}
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now int64
+}
+
+func (c *fakeClock) Now() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Set(now int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+}
+
+func (c *fakeClock) Sleep(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now += d.Milliseconds()
+}
+
+func newFakeWorker(nodeId int64, clock *fakeClock) *Worker {
+	w, _ := NewWorker(nodeId)
+	w.clock = clock.Now
+	w.sleep = clock.Sleep
+	return w
+}
+
+func TestSnowflake_ClockSkew(t *testing.T) {
+	start := DefaultConfig.Epoch.UnixMilli() + 1_000
+
+	t.Run("Fails when time moves backwards by default", func(t *testing.T) {
+		clock := &fakeClock{now: start}
+		w := newFakeWorker(1, clock)
+
+		if _, err := w.NextId(); err != nil {
+			t.Fatalf("Error getting next Id: %v", err)
+		}
+
+		clock.Set(start - 1)
+
+		if _, err := w.NextId(); err == nil {
+			t.Fatalf("Expected an error when time moves backwards")
+		}
+	})
+
+	t.Run("Waits out small regressions", func(t *testing.T) {
+		clock := &fakeClock{now: start}
+		w := newFakeWorker(1, clock)
+		w.SetSkewPolicy(SkewWait, 10*time.Millisecond)
+
+		first, err := w.NextId()
+		if err != nil {
+			t.Fatalf("Error getting next Id: %v", err)
+		}
+
+		clock.Set(start - 5)
+
+		second, err := w.NextId()
+		if err != nil {
+			t.Fatalf("Error getting next Id: %v", err)
+		}
+
+		if second <= first {
+			t.Fatalf("Expected Ids to keep increasing, got %d then %d", first, second)
+		}
+		if clock.Now() < start {
+			t.Fatalf("Expected worker to sleep until the clock caught up, clock is at %d", clock.Now())
+		}
+	})
+
+	t.Run("Borrows sequence space from the last timestamp", func(t *testing.T) {
+		clock := &fakeClock{now: start}
+		w := newFakeWorker(1, clock)
+		w.SetSkewPolicy(SkewBorrow, 10*time.Millisecond)
+
+		prev, err := w.NextId()
+		if err != nil {
+			t.Fatalf("Error getting next Id: %v", err)
+		}
+
+		clock.Set(start - 5)
+
+		// enough Ids to run out of sequence space on the last timestamp
+		for i := int64(0); i < w.sequenceMask+10; i++ {
+			id, err := w.NextId()
+			if err != nil {
+				t.Fatalf("Error getting next Id: %v", err)
+			}
+			if id <= prev {
+				t.Fatalf("Expected Ids to keep increasing, got %d then %d", prev, id)
+			}
+			prev = id
+		}
+
+		if clock.Now() != start-5 {
+			t.Fatalf("Expected borrowing not to wait for the clock, clock is at %d", clock.Now())
+		}
+	})
+
+	t.Run("Fails above the skew threshold", func(t *testing.T) {
+		for _, policy := range []SkewPolicy{SkewWait, SkewBorrow} {
+			clock := &fakeClock{now: start}
+			w := newFakeWorker(1, clock)
+			w.SetSkewPolicy(policy, 10*time.Millisecond)
+
+			if _, err := w.NextId(); err != nil {
+				t.Fatalf("Error getting next Id: %v", err)
+			}
+
+			clock.Set(start - 11)
+
+			if _, err := w.NextId(); err == nil {
+				t.Fatalf("Expected an error for policy %d when skew exceeds the threshold", policy)
+			}
+		}
+	})
+}
+
+func TestSnowflake_NodeIds(t *testing.T) {
+	t.Run("Parses Maelstrom node IDs", func(t *testing.T) {
+		tests := []struct {
+			id       string
+			expected int64
+		}{
+			{id: "n0", expected: 0},
+			{id: "n3", expected: 3},
+			{id: "n1023", expected: 1023},
+		}
+
+		for _, tt := range tests {
+			nodeId, err := ParseNodeId(tt.id)
+			if err != nil {
+				t.Fatalf("Error parsing node ID %s: %v", tt.id, err)
+			}
+			if nodeId != tt.expected {
+				t.Fatalf("Wrong node ID for %s, expected %d, got %d", tt.id, tt.expected, nodeId)
+			}
+		}
+	})
+
+	t.Run("Rejects invalid node IDs", func(t *testing.T) {
+		for _, id := range []string{"", "c1", "n", "nx", "n-1", "n1024"} {
+			if _, err := NewWorkerForNode(id); err == nil {
+				t.Fatalf("Expected an error for node ID %q", id)
+			}
+		}
+	})
+
+	t.Run("Rejects node IDs that do not fit in the node bits", func(t *testing.T) {
+		if _, err := NewWorker(1024); err == nil {
+			t.Fatalf("Expected an error for node ID %d", 1024)
+		}
+	})
+}
+
+func TestSnowflake_Config(t *testing.T) {
+	t.Run("Rejects layouts that do not fit in 64 bits", func(t *testing.T) {
+		cfg := DefaultConfig
+		cfg.TimestampBits = 43
+
+		if _, err := NewWorkerWithConfig(1, cfg); err == nil {
+			t.Fatalf("Expected an error for a %d bit layout", cfg.TimestampBits+cfg.NodeIdBits+cfg.SequenceBits)
+		}
+	})
+
+	t.Run("Rejects node IDs that do not fit in the configured node bits", func(t *testing.T) {
+		cfg := DefaultConfig
+		cfg.NodeIdBits = 2
+
+		if _, err := NewWorkerWithConfig(3, cfg); err != nil {
+			t.Fatalf("Error creating worker: %v", err)
+		}
+		if _, err := NewWorkerWithConfig(4, cfg); err == nil {
+			t.Fatalf("Expected an error for node ID %d with %d node bits", 4, cfg.NodeIdBits)
+		}
+	})
+
+	t.Run("Lays out Ids as configured", func(t *testing.T) {
+		cfg := Config{
+			TimestampBits: 40,
+			NodeIdBits:    16,
+			SequenceBits:  8,
+			Epoch:         time.UnixMilli(1_000),
+		}
+		clock := &fakeClock{now: 1_005}
+
+		w, err := NewWorkerWithConfig(7, cfg)
+		if err != nil {
+			t.Fatalf("Error creating worker: %v", err)
+		}
+		w.clock = clock.Now
+
+		id, err := w.NextId()
+		if err != nil {
+			t.Fatalf("Error getting next Id: %v", err)
+		}
+
+		expected := uint64(5)<<24 | uint64(7)<<8
+		if id != expected {
+			t.Fatalf("Wrong Id layout, expected %d, got %d", expected, id)
+		}
+	})
+
+	t.Run("Uses the whole 64 bits", func(t *testing.T) {
+		cfg := Config{
+			TimestampBits: 44,
+			NodeIdBits:    10,
+			SequenceBits:  10,
+			Epoch:         time.UnixMilli(0),
+		}
+		clock := &fakeClock{now: 1 << 43}
+
+		w, err := NewWorkerWithConfig(1, cfg)
+		if err != nil {
+			t.Fatalf("Error creating worker: %v", err)
+		}
+		w.clock = clock.Now
+
+		id, err := w.NextId()
+		if err != nil {
+			t.Fatalf("Error getting next Id: %v", err)
+		}
+		if id>>63 != 1 {
+			t.Fatalf("Expected the top bit to hold the timestamp, got %b", id)
+		}
+
+		clock.Set(1 << 44)
+		if _, err := w.NextId(); err == nil {
+			t.Fatalf("Expected an error once the timestamp outgrows its bits")
+		}
+	})
+}
+
+func TestSnowflake_Decode(t *testing.T) {
+	t.Run("Recovers the parts of an Id", func(t *testing.T) {
+		clock := &fakeClock{now: DefaultConfig.Epoch.UnixMilli() + 1_234}
+		w := newFakeWorker(42, clock)
+
+		for i := int64(0); i < 3; i++ {
+			id, err := w.NextId()
+			if err != nil {
+				t.Fatalf("Error getting next Id: %v", err)
+			}
+
+			parts := w.Decode(id)
+			expected := Parts{
+				Timestamp: 1_234,
+				NodeId:    42,
+				Sequence:  i,
+				Time:      DefaultConfig.Epoch.Add(1_234 * time.Millisecond),
+			}
+			if parts != expected {
+				t.Fatalf("Wrong parts for Id %d, expected %+v, got %+v", id, expected, parts)
+			}
+			if Decode(id) != parts {
+				t.Fatalf("Decode with the default config disagrees with the worker, expected %+v, got %+v", parts, Decode(id))
+			}
+		}
+	})
+
+	t.Run("Uses the worker's layout and epoch", func(t *testing.T) {
+		cfg := Config{
+			TimestampBits: 40,
+			NodeIdBits:    16,
+			SequenceBits:  8,
+			Epoch:         time.UnixMilli(1_000),
+		}
+		clock := &fakeClock{now: 1_005}
+
+		w, err := NewWorkerWithConfig(300, cfg)
+		if err != nil {
+			t.Fatalf("Error creating worker: %v", err)
+		}
+		w.clock = clock.Now
+
+		id, err := w.NextId()
+		if err != nil {
+			t.Fatalf("Error getting next Id: %v", err)
+		}
+
+		parts := w.Decode(id)
+		if parts.Timestamp != 5 || parts.NodeId != 300 || parts.Sequence != 0 {
+			t.Fatalf("Wrong parts for Id %d: %+v", id, parts)
+		}
+		if !parts.Time.Equal(time.UnixMilli(1_005)) {
+			t.Fatalf("Wrong time for Id %d, expected %v, got %v", id, time.UnixMilli(1_005), parts.Time)
+		}
+	})
+}
+
+func TestSnowflake_NextIds(t *testing.T) {
+	t.Run("Generates a run of increasing Ids", func(t *testing.T) {
+		w, _ := NewWorker(1)
+
+		ids, err := w.NextIds(10_000)
+		if err != nil {
+			t.Fatalf("Error getting next Ids: %v", err)
+		}
+
+		if len(ids) != 10_000 {
+			t.Fatalf("Expected %d Ids, got %d", 10_000, len(ids))
+		}
+		for i := 1; i < len(ids); i++ {
+			if ids[i] <= ids[i-1] {
+				t.Fatalf("Expected Ids to keep increasing, got %d then %d", ids[i-1], ids[i])
+			}
+		}
+	})
+
+	t.Run("Sleeps instead of spinning when the sequence runs out", func(t *testing.T) {
+		start := DefaultConfig.Epoch.UnixMilli() + 1_000
+		clock := &fakeClock{now: start}
+		w := newFakeWorker(1, clock)
+
+		ids, err := w.NextIds(int(w.sequenceMask) + 2)
+		if err != nil {
+			t.Fatalf("Error getting next Ids: %v", err)
+		}
+
+		last := w.Decode(ids[len(ids)-1])
+		if last.Timestamp != 1_001 || last.Sequence != 0 {
+			t.Fatalf("Expected the run to move on to the next millisecond, got %+v", last)
+		}
+		if clock.Now() != start+1 {
+			t.Fatalf("Expected the worker to sleep for one millisecond, clock is at %d", clock.Now())
+		}
+	})
+
+	t.Run("Rejects negative counts", func(t *testing.T) {
+		w, _ := NewWorker(1)
+
+		if _, err := w.NextIds(-1); err == nil {
+			t.Fatalf("Expected an error for a negative count")
+		}
+	})
+
+	t.Run("Rejects counts over the cap", func(t *testing.T) {
+		w, _ := NewWorker(1)
+
+		if _, err := w.NextIds(MaxRun + 1); err == nil {
+			t.Fatalf("Expected an error for a count over %d", MaxRun)
+		}
+	})
+}
+
+func TestSnowflake_Observe(t *testing.T) {
+	start := DefaultConfig.Epoch.UnixMilli() + 1_000
+
+	t.Run("Generates Ids above an Id from a higher node in the same millisecond", func(t *testing.T) {
+		clock := &fakeClock{now: start}
+		w := newFakeWorker(1, clock)
+		other := newFakeWorker(5, clock)
+
+		if _, err := w.NextId(); err != nil {
+			t.Fatalf("Error getting next Id: %v", err)
+		}
+		observed, _ := other.NextId()
+
+		w.Observe(observed)
+		id, err := w.NextId()
+		if err != nil {
+			t.Fatalf("Error getting next Id: %v", err)
+		}
+		if id <= observed {
+			t.Fatalf("Expected an Id above %d, got %d", observed, id)
+		}
+	})
+
+	t.Run("Borrows from the future when an observed Id is ahead of the clock", func(t *testing.T) {
+		clock := &fakeClock{now: start}
+		w := newFakeWorker(1, clock)
+		ahead := newFakeWorker(2, &fakeClock{now: start + 500})
+		observed, _ := ahead.NextId()
+
+		w.Observe(observed)
+		ids, err := w.NextIds(int(w.sequenceMask) + 2)
+		if err != nil {
+			t.Fatalf("Expected no skew error while ahead of the clock, got %v", err)
+		}
+		for i, id := range ids {
+			if id <= observed || (i > 0 && id <= ids[i-1]) {
+				t.Fatalf("Expected Ids to keep increasing past %d, got %d at %d", observed, id, i)
+			}
+		}
+		if clock.Now() != start {
+			t.Fatalf("Expected the worker not to sleep while ahead of the clock, clock is at %d", clock.Now())
+		}
+
+		// once the clock overtakes it, the worker goes back to the clock
+		clock.Set(start + 1_000)
+		id, _ := w.NextId()
+		if parts := w.Decode(id); parts.Timestamp != 2_000 {
+			t.Fatalf("Expected to be back on the clock, got %+v", parts)
+		}
+	})
+
+	t.Run("Ignores Ids below the last one generated", func(t *testing.T) {
+		clock := &fakeClock{now: start}
+		w := newFakeWorker(3, clock)
+		old := newFakeWorker(1, &fakeClock{now: start - 10})
+		observed, _ := old.NextId()
+
+		first, _ := w.NextId()
+		w.Observe(observed)
+		second, _ := w.NextId()
+
+		if parts := w.Decode(second); parts.Timestamp != 1_000 || parts.Sequence != 1 || second <= first {
+			t.Fatalf("Expected observing an old Id to change nothing, got %+v", parts)
+		}
+	})
+
+	t.Run("Still fails on real skew after catching up", func(t *testing.T) {
+		clock := &fakeClock{now: start}
+		w := newFakeWorker(1, clock)
+		ahead := newFakeWorker(2, &fakeClock{now: start + 5})
+		observed, _ := ahead.NextId()
+
+		w.Observe(observed)
+		clock.Set(start + 10)
+		if _, err := w.NextId(); err != nil {
+			t.Fatalf("Error getting next Id: %v", err)
+		}
+
+		clock.Set(start + 8)
+		if _, err := w.NextId(); err == nil {
+			t.Fatalf("Expected the clock moving backwards to fail")
+		}
+	})
+}
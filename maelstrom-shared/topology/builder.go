@@ -0,0 +1,181 @@
+package topology
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Builder works out every node's neighbours. It is given the cluster's node
+// IDs, in the same order on every node, and the topology Maelstrom
+// suggested, which it is free to ignore.
+type Builder func(nodeIds []string, suggested map[string][]string) map[string][]string
+
+// ByName returns the builder for one of "maelstrom", "star", "tree",
+// "kary:<k>" or "grid".
+func ByName(name string) (Builder, error) {
+	switch name {
+	case "", "maelstrom":
+		return Suggested, nil
+	case "star":
+		return Star, nil
+	case "tree":
+		return SpanningTree, nil
+	case "grid":
+		return Grid, nil
+	}
+
+	if arity, ok := strings.CutPrefix(name, "kary:"); ok {
+		k, err := strconv.Atoi(arity)
+		if err != nil || k < 1 {
+			return nil, fmt.Errorf("invalid topology %q: arity must be a positive integer", name)
+		}
+		return KAry(k), nil
+	}
+
+	return nil, fmt.Errorf("unknown topology %q", name)
+}
+
+// Suggested uses the topology Maelstrom sent as it is.
+func Suggested(nodeIds []string, suggested map[string][]string) map[string][]string {
+	return suggested
+}
+
+// Star connects every node to the first one.
+func Star(nodeIds []string, suggested map[string][]string) map[string][]string {
+	g := newGraph(nodeIds)
+	if len(nodeIds) == 0 {
+		return g
+	}
+
+	for _, id := range nodeIds[1:] {
+		g.connect(nodeIds[0], id)
+	}
+	return g
+}
+
+// SpanningTree keeps just enough of the suggested topology to reach every
+// node from the first one, taking the shortest route to each. Nodes the
+// suggested topology can't reach are hung off the first node.
+func SpanningTree(nodeIds []string, suggested map[string][]string) map[string][]string {
+	g := newGraph(nodeIds)
+	if len(nodeIds) == 0 {
+		return g
+	}
+
+	seen := map[string]bool{nodeIds[0]: true}
+	queue := []string{nodeIds[0]}
+	for len(queue) > 0 {
+		curr := queue[0]
+		queue = queue[1:]
+
+		for _, nbr := range suggested[curr] {
+			if _, ok := g[nbr]; !ok || seen[nbr] {
+				continue
+			}
+			seen[nbr] = true
+			g.connect(curr, nbr)
+			queue = append(queue, nbr)
+		}
+	}
+
+	for _, id := range nodeIds {
+		if !seen[id] {
+			g.connect(nodeIds[0], id)
+		}
+	}
+
+	return g
+}
+
+// KAry arranges the nodes into a tree where each node has up to k children,
+// filled in node ID order.
+func KAry(k int) Builder {
+	return func(nodeIds []string, suggested map[string][]string) map[string][]string {
+		g := newGraph(nodeIds)
+		for i := 1; i < len(nodeIds); i++ {
+			g.connect(nodeIds[(i-1)/k], nodeIds[i])
+		}
+		return g
+	}
+}
+
+// Grid lays the nodes out row by row in a square grid and connects each
+// one to the nodes next to it horizontally and vertically.
+func Grid(nodeIds []string, suggested map[string][]string) map[string][]string {
+	g := newGraph(nodeIds)
+	width := int(math.Ceil(math.Sqrt(float64(len(nodeIds)))))
+
+	for i := range nodeIds {
+		if (i+1)%width != 0 && i+1 < len(nodeIds) {
+			g.connect(nodeIds[i], nodeIds[i+1])
+		}
+		if i+width < len(nodeIds) {
+			g.connect(nodeIds[i], nodeIds[i+width])
+		}
+	}
+
+	return g
+}
+
+type graph map[string][]string
+
+func newGraph(nodeIds []string) graph {
+	g := make(graph)
+	for _, id := range nodeIds {
+		g[id] = []string{}
+	}
+	return g
+}
+
+func (g graph) connect(a string, b string) {
+	g[a] = append(g[a], b)
+	g[b] = append(g[b], a)
+}
+
+// Metrics summarise how a topology trades latency against messages.
+type Metrics struct {
+	// Diameter is the most hops between any two nodes, or -1 if some nodes
+	// can't reach each other.
+	Diameter int
+	// MaxFanOut is the most neighbours any one node has.
+	MaxFanOut int
+	// Edges is the number of neighbour links, counting each direction.
+	Edges int
+}
+
+// Measure works out the metrics of a topology.
+func Measure(topology map[string][]string) Metrics {
+	var m Metrics
+
+	for _, nbrs := range topology {
+		m.MaxFanOut = max(m.MaxFanOut, len(nbrs))
+		m.Edges += len(nbrs)
+	}
+
+	for id := range topology {
+		dist := map[string]int{id: 0}
+		queue := []string{id}
+		for len(queue) > 0 {
+			curr := queue[0]
+			queue = queue[1:]
+
+			for _, nbr := range topology[curr] {
+				if _, ok := dist[nbr]; ok {
+					continue
+				}
+				dist[nbr] = dist[curr] + 1
+				m.Diameter = max(m.Diameter, dist[nbr])
+				queue = append(queue, nbr)
+			}
+		}
+
+		if len(dist) < len(topology) {
+			m.Diameter = -1
+			return m
+		}
+	}
+
+	return m
+}
@@ -0,0 +1,108 @@
+package topology
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func nodeIds(count int) []string {
+	ids := make([]string, count)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("n%d", i)
+	}
+	return ids
+}
+
+func TestBuilders(t *testing.T) {
+	ring := map[string][]string{}
+	ids := nodeIds(9)
+	for i, id := range ids {
+		ring[id] = []string{ids[(i+1)%len(ids)], ids[(i+len(ids)-1)%len(ids)]}
+	}
+
+	tests := []struct {
+		name     string
+		expected Metrics
+	}{
+		{name: "maelstrom", expected: Metrics{Diameter: 4, MaxFanOut: 2, Edges: 18}},
+		{name: "star", expected: Metrics{Diameter: 2, MaxFanOut: 8, Edges: 16}},
+		{name: "tree", expected: Metrics{Diameter: 8, MaxFanOut: 2, Edges: 16}},
+		{name: "kary:2", expected: Metrics{Diameter: 5, MaxFanOut: 3, Edges: 16}},
+		{name: "kary:8", expected: Metrics{Diameter: 2, MaxFanOut: 8, Edges: 16}},
+		{name: "grid", expected: Metrics{Diameter: 4, MaxFanOut: 4, Edges: 24}},
+	}
+
+	for _, tt := range tests {
+		builder, err := ByName(tt.name)
+		if err != nil {
+			t.Fatalf("error getting builder %s: %v", tt.name, err)
+		}
+
+		topology := builder(ids, ring)
+
+		for id, nbrs := range topology {
+			for _, nbr := range nbrs {
+				if !slices.Contains(topology[nbr], id) {
+					t.Fatalf("%s: %s is a neighbour of %s but not the other way round", tt.name, nbr, id)
+				}
+			}
+		}
+
+		if metrics := Measure(topology); metrics != tt.expected {
+			t.Fatalf("%s: wrong metrics. expected %+v, got %+v", tt.name, tt.expected, metrics)
+		}
+	}
+}
+
+func TestBuildersWithoutNodes(t *testing.T) {
+	for _, name := range []string{"star", "tree", "kary:2", "grid"} {
+		builder, err := ByName(name)
+		if err != nil {
+			t.Fatalf("error getting builder %s: %v", name, err)
+		}
+
+		if topology := builder([]string{}, nil); len(topology) != 0 {
+			t.Fatalf("%s: expected an empty topology, got %v", name, topology)
+		}
+	}
+}
+
+func TestSpanningTreeReachesEveryNode(t *testing.T) {
+	ids := nodeIds(4)
+	// n3 is missing from the suggested topology altogether
+	suggested := map[string][]string{
+		"n0": {"n1"},
+		"n1": {"n0", "n2"},
+		"n2": {"n1"},
+	}
+
+	topology := SpanningTree(ids, suggested)
+
+	if metrics := Measure(topology); metrics.Diameter < 0 {
+		t.Fatalf("expected every node to be reachable, got %v", topology)
+	}
+	if !slices.Contains(topology["n0"], "n3") {
+		t.Fatalf("expected n3 to be attached to n0, got %v", topology)
+	}
+}
+
+func TestMeasureDisconnected(t *testing.T) {
+	topology := map[string][]string{
+		"n0": {"n1"},
+		"n1": {"n0"},
+		"n2": {},
+	}
+
+	if metrics := Measure(topology); metrics.Diameter != -1 {
+		t.Fatalf("expected diameter -1 for a disconnected topology, got %d", metrics.Diameter)
+	}
+}
+
+func TestByNameRejectsUnknown(t *testing.T) {
+	for _, name := range []string{"ring", "kary:", "kary:0", "kary:x"} {
+		if _, err := ByName(name); err == nil {
+			t.Fatalf("expected an error for topology %q", name)
+		}
+	}
+}
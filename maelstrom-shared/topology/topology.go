@@ -0,0 +1,36 @@
+package topology
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+type topologyBody struct {
+	Topology map[string][]string
+}
+
+// ParseAll reads the whole suggested topology out of the body of a Maelstrom
+// topology message.
+func ParseAll(body json.RawMessage) (map[string][]string, error) {
+	var msg topologyBody
+
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, fmt.Errorf("unmarshal topology message body: %w", err)
+	}
+
+	return msg.Topology, nil
+}
+
+// Parse reads the neighbours of node id out of the body of a Maelstrom
+// topology message.
+func Parse(body json.RawMessage, id string) ([]string, error) {
+	topology, err := ParseAll(body)
+	if err != nil {
+		return nil, err
+	}
+
+	nbrs := make([]string, len(topology[id]))
+	copy(nbrs, topology[id])
+
+	return nbrs, nil
+}
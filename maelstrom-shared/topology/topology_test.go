@@ -0,0 +1,34 @@
+package topology
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	body := []byte(`{"type":"topology","topology":{"n0":["n1","n2"],"n1":["n0"],"n2":["n0"]},"msg_id":1}`)
+
+	tests := []struct {
+		id       string
+		expected []string
+	}{
+		{id: "n0", expected: []string{"n1", "n2"}},
+		{id: "n1", expected: []string{"n0"}},
+		{id: "n3", expected: []string{}},
+	}
+
+	for _, tt := range tests {
+		nbrs, err := Parse(body, tt.id)
+		if err != nil {
+			t.Fatalf("error parsing topology: %v", err)
+		}
+
+		if !slices.Equal(nbrs, tt.expected) {
+			t.Fatalf("wrong neighbours for %s. expected %v, got %v", tt.id, tt.expected, nbrs)
+		}
+	}
+
+	if _, err := Parse([]byte(`{"topology":["n0"]}`), "n0"); err == nil {
+		t.Fatalf("expected an error for a malformed topology")
+	}
+}
@@ -0,0 +1,98 @@
+// Package txntest holds the helpers the txn servers' tests share for driving
+// a server through its handlers and reading back what it sent.
+package txntest
+
+import (
+	"bytes"
+	"encoding/json"
+	"maelstrom-shared/microop"
+	"maelstrom-shared/replog"
+	"strings"
+	"testing"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+// NewNode returns a node initialised as id in a cluster of nodeIds, writing
+// what it sends to the returned buffer.
+func NewNode(id string, nodeIds []string) (*maelstrom.Node, *bytes.Buffer) {
+	var out bytes.Buffer
+
+	n := maelstrom.NewNode()
+	n.Init(id, nodeIds)
+	n.Stdout = &out
+
+	return n, &out
+}
+
+// Sent returns the messages written to out and empties it.
+func Sent(t *testing.T, out *bytes.Buffer) []maelstrom.Message {
+	msgs := make([]maelstrom.Message, 0)
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		if line == "" {
+			continue
+		}
+
+		var msg maelstrom.Message
+		if err := json.Unmarshal([]byte(line), &msg); err != nil {
+			t.Fatalf("error unmarshalling message: %v", err)
+		}
+		msgs = append(msgs, msg)
+	}
+	out.Reset()
+
+	return msgs
+}
+
+// Txn runs ops, a JSON list of micro-ops, through handle as a client's txn
+// request to dest and returns the ops from the txn_ok reply.
+func Txn(t *testing.T, handle maelstrom.HandlerFunc, out *bytes.Buffer, dest string, ops string) []microop.Op {
+	body := []byte(`{"type": "txn", "msg_id": 1, "txn": ` + ops + `}`)
+	if err := handle(maelstrom.Message{Src: "c1", Dest: dest, Body: body}); err != nil {
+		t.Fatalf("error handling txn: %v", err)
+	}
+
+	msgs := Sent(t, out)
+	var res struct {
+		Type string
+		Txn  []microop.Op
+	}
+	if err := json.Unmarshal(msgs[len(msgs)-1].Body, &res); err != nil {
+		t.Fatalf("error unmarshalling reply: %v", err)
+	}
+	if res.Type != "txn_ok" {
+		t.Fatalf("expected txn_ok, got %s", res.Type)
+	}
+
+	return res.Txn
+}
+
+// Exchange delivers each log's next unacknowledged batch to the other, and
+// the acknowledgements back.
+func Exchange[T any](t *testing.T, l0, l1 *replog.Log[T], out0, out1 *bytes.Buffer) {
+	l0.GossipOnce()
+	l1.GossipOnce()
+
+	for out0.Len() > 0 || out1.Len() > 0 {
+		for _, pair := range []struct {
+			out *bytes.Buffer
+			to  *replog.Log[T]
+		}{{out0, l1}, {out1, l0}} {
+			for _, msg := range Sent(t, pair.out) {
+				handle := pair.to.HandleReplicate
+				if msg.Type() == "replicate_ok" {
+					handle = pair.to.HandleReplicateOk
+				}
+
+				if err := handle(msg); err != nil {
+					t.Fatalf("error handling %s: %v", msg.Type(), err)
+				}
+			}
+		}
+	}
+}
+
+// IntPtr returns a pointer to i, for building a write's value.
+func IntPtr(i int) *int {
+	return &i
+}